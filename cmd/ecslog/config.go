@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/pelletier/go-toml"
+	"github.com/trentm/go-ecslog/internal/ecslog"
 	"github.com/trentm/go-ecslog/internal/lg"
 )
 
@@ -70,6 +73,319 @@ func (c *config) GetString(key string) (val string, ok bool) {
 	return
 }
 
+// GetStringArray gets the value of the `key` from the config file if it is
+// an array of strings.
+func (c *config) GetStringArray(key string) (val []string, ok bool) {
+	if c.tree == nil {
+		return nil, false
+	}
+	item := c.tree.Get(key)
+	if item == nil {
+		return nil, false
+	}
+	val, ok = stringArray(item)
+	if !ok {
+		lg.Printf("ignore config value: not string array: %s=%v (%T)\n", key, item, item)
+		return nil, false
+	}
+	return
+}
+
+// GetFieldMappings gets the `[[mappings]]` tables from the config file, e.g.:
+//
+//    [[mappings]]
+//    from = "severity"
+//    to = "log.level"
+//    values = { WARNING = "warn", ERROR = "error" }
+//    when = "service.name:billing"
+//
+// Unlike other config values, invalid mappings are an error rather than
+// ignored, because ignoring one would change how records are rendered.
+func (c *config) GetFieldMappings() ([]ecslog.FieldMapping, error) {
+	if c.tree == nil {
+		return nil, nil
+	}
+	item := c.tree.Get("mappings")
+	if item == nil {
+		return nil, nil
+	}
+	tables, ok := item.([]*toml.Tree)
+	if !ok {
+		return nil, fmt.Errorf("invalid config: 'mappings' must be an array of tables ([[mappings]])")
+	}
+
+	var mappings []ecslog.FieldMapping
+	for i, t := range tables {
+		var m ecslog.FieldMapping
+		for _, key := range t.Keys() {
+			var ok bool
+			switch key {
+			case "from":
+				m.From, ok = t.Get(key).(string)
+			case "to":
+				m.To, ok = t.Get(key).(string)
+			case "when":
+				m.When, ok = t.Get(key).(string)
+			case "values":
+				var values *toml.Tree
+				values, ok = t.Get(key).(*toml.Tree)
+				if ok {
+					m.Values = make(map[string]string)
+					for _, v := range values.Keys() {
+						if m.Values[v], ok = values.Get(v).(string); !ok {
+							return nil, fmt.Errorf("invalid config: mappings[%d]: values.%s is not a string", i+1, v)
+						}
+					}
+				}
+			default:
+				return nil, fmt.Errorf("invalid config: mappings[%d]: unknown key '%s' (known keys: from, to, values, when)", i+1, key)
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid config: mappings[%d]: '%s' has the wrong type", i+1, key)
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+// GetHumanizeFields gets the `[humanizeFields]` table from the config file,
+// which maps field names, or "*.NAME" patterns, to a humanize kind, e.g.:
+//
+//    [humanizeFields]
+//    "myapp.elapsed" = "duration:ms"
+//    "*.size" = "bytes"
+//
+// Nested tables are flattened to dotted field names. As with
+// `GetFieldMappings`, an invalid table is an error.
+func (c *config) GetHumanizeFields() (map[string]string, error) {
+	if c.tree == nil {
+		return nil, nil
+	}
+	item := c.tree.Get("humanizeFields")
+	if item == nil {
+		return nil, nil
+	}
+	t, ok := item.(*toml.Tree)
+	if !ok {
+		return nil, fmt.Errorf("invalid config: 'humanizeFields' must be a table ([humanizeFields])")
+	}
+	fields := make(map[string]string)
+	if err := flattenHumanizeFields(fields, "", t); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func flattenHumanizeFields(fields map[string]string, prefix string, t *toml.Tree) error {
+	for _, key := range t.Keys() {
+		// Use GetPath to not split quoted keys, e.g. "*.size", on '.'.
+		switch v := t.GetPath([]string{key}).(type) {
+		case string:
+			fields[prefix+key] = v
+		case *toml.Tree:
+			if err := flattenHumanizeFields(fields, prefix+key+".", v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid config: humanizeFields.%s%s is not a string", prefix, key)
+		}
+	}
+	return nil
+}
+
+// format is the settings of an output format: a built-in format or a
+// `[formats.NAME]` table from the config file. Nil or empty settings are
+// unset.
+type format struct {
+	base          string // the name of the built-in format
+	excludeFields []string
+	includeFields []string
+	titleFields   []string
+	title         string
+	colorScheme   string
+	level         string
+}
+
+// formatDef is a `[formats.NAME]` table from the config file.
+type formatDef struct {
+	inherit  string
+	settings format
+}
+
+// formatKeys are the known keys in a `[formats.NAME]` table.
+var formatKeys = []string{"inherit", "excludeFields", "includeFields", "titleFields", "title", "colorScheme", "level"}
+
+// GetFormat gets the settings for the output format with the given name.
+// User-defined formats are tables in the config file, e.g.:
+//
+//    [formats.trent]
+//    inherit = "compact"
+//    excludeFields = ["process", "host"]
+//    level = "info"
+//
+// A format inherits the settings of its "inherit" format (by default
+// "default"), which is a built-in format or another user-defined format. It
+// is an error if there is no format with the given name.
+//
+// As with `GetFieldMappings`, invalid formats are an error, even if they are
+// not used.
+func (c *config) GetFormat(name string) (*format, error) {
+	defs, err := c.getFormatDefs()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range defs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if _, err := resolveFormat(n, defs); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := defs[name]; !ok && !isBuiltinFormat(name) {
+		return nil, fmt.Errorf("unknown format '%s' (known formats: %s)",
+			name, strings.Join(formatNames(defs), ", "))
+	}
+	return resolveFormat(name, defs)
+}
+
+// getFormatDefs gets the `[formats.NAME]` tables from the config file.
+func (c *config) getFormatDefs() (map[string]*formatDef, error) {
+	defs := make(map[string]*formatDef)
+	if c.tree == nil {
+		return defs, nil
+	}
+	item := c.tree.Get("formats")
+	if item == nil {
+		return defs, nil
+	}
+	tables, ok := item.(*toml.Tree)
+	if !ok {
+		return nil, fmt.Errorf("invalid config: 'formats' must be a table of tables ([formats.NAME])")
+	}
+	for _, name := range tables.Keys() {
+		if isBuiltinFormat(name) {
+			return nil, fmt.Errorf("invalid config: formats.%s: cannot redefine a built-in format", name)
+		}
+		t, ok := tables.Get(name).(*toml.Tree)
+		if !ok {
+			return nil, fmt.Errorf("invalid config: formats.%s must be a table", name)
+		}
+		def := &formatDef{inherit: "default"}
+		f := &def.settings
+		for _, key := range t.Keys() {
+			switch key {
+			case "inherit":
+				def.inherit, ok = t.Get(key).(string)
+			case "excludeFields":
+				f.excludeFields, ok = stringArray(t.Get(key))
+			case "includeFields":
+				f.includeFields, ok = stringArray(t.Get(key))
+			case "titleFields":
+				f.titleFields, ok = stringArray(t.Get(key))
+			case "title":
+				f.title, ok = t.Get(key).(string)
+			case "colorScheme":
+				f.colorScheme, ok = t.Get(key).(string)
+			case "level":
+				f.level, ok = t.Get(key).(string)
+			default:
+				return nil, fmt.Errorf("invalid config: formats.%s: unknown key '%s' (known keys: %s)",
+					name, key, strings.Join(formatKeys, ", "))
+			}
+			if !ok {
+				return nil, fmt.Errorf("invalid config: formats.%s: '%s' has the wrong type", name, key)
+			}
+		}
+		defs[name] = def
+	}
+	return defs, nil
+}
+
+// resolveFormat returns the settings for the given built-in or user-defined
+// format, by applying the settings of each format in its inheritance chain.
+func resolveFormat(name string, defs map[string]*formatDef) (*format, error) {
+	chain := []string{name}
+	for !isBuiltinFormat(name) {
+		def := defs[name]
+		for _, n := range chain {
+			if n == def.inherit {
+				return nil, fmt.Errorf("invalid config: formats.%s: inheritance cycle: %s -> %s",
+					chain[0], strings.Join(chain, " -> "), def.inherit)
+			}
+		}
+		if _, ok := defs[def.inherit]; !ok && !isBuiltinFormat(def.inherit) {
+			return nil, fmt.Errorf("invalid config: formats.%s: cannot inherit from unknown format '%s' (known formats: %s)",
+				name, def.inherit, strings.Join(formatNames(defs), ", "))
+		}
+		name = def.inherit
+		chain = append(chain, name)
+	}
+
+	f := &format{base: name}
+	for i := len(chain) - 2; i >= 0; i-- {
+		s := &defs[chain[i]].settings
+		if s.excludeFields != nil {
+			f.excludeFields = s.excludeFields
+		}
+		if s.includeFields != nil {
+			f.includeFields = s.includeFields
+		}
+		if s.titleFields != nil {
+			f.titleFields = s.titleFields
+		}
+		if s.title != "" {
+			f.title = s.title
+		}
+		if s.colorScheme != "" {
+			f.colorScheme = s.colorScheme
+		}
+		if s.level != "" {
+			f.level = s.level
+		}
+	}
+	return f, nil
+}
+
+// formatNames returns the names of the built-in formats, then of the
+// user-defined formats, each sorted.
+func formatNames(defs map[string]*formatDef) []string {
+	var names []string
+	for n := range defs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return append(ecslog.FormatNames(), names...)
+}
+
+func isBuiltinFormat(name string) bool {
+	for _, n := range ecslog.FormatNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stringArray returns the given config value as a slice of strings, if it is
+// an array of strings.
+func stringArray(item interface{}) ([]string, bool) {
+	items, ok := item.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(items))
+	for i, it := range items {
+		if strs[i], ok = it.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
+
 func configFilePath() string {
 	var homeEnvVar string
 	if runtime.GOOS == "windows" {
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/pelletier/go-toml"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestGetFieldMappings(t *testing.T) {
+	testCases := []struct {
+		name    string
+		toml    string
+		want    []ecslog.FieldMapping
+		wantErr string
+	}{
+		{
+			"none",
+			`format="compact"`,
+			nil,
+			"",
+		},
+		{
+			"mappings",
+			`
+[[mappings]]
+from = "severity"
+to = "log.level"
+values = { WARNING = "warn", 30 = "info" }
+
+[[mappings]]
+from = "logger_name"
+to = "log.logger"
+when = "service.name:billing"
+`,
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level", Values: map[string]string{"WARNING": "warn", "30": "info"}},
+				{From: "logger_name", To: "log.logger", When: "service.name:billing"},
+			},
+			"",
+		},
+		{
+			"not an array of tables",
+			`mappings = "severity"`,
+			nil,
+			"invalid config: 'mappings' must be an array of tables ([[mappings]])",
+		},
+		{
+			"unknown key",
+			"[[mappings]]\nfrom = \"a\"\ntoo = \"b\"\n",
+			nil,
+			"invalid config: mappings[1]: unknown key 'too' (known keys: from, to, values, when)",
+		},
+		{
+			"wrong type",
+			"[[mappings]]\nfrom = 1\nto = \"b\"\n",
+			nil,
+			"invalid config: mappings[1]: 'from' has the wrong type",
+		},
+		{
+			"non-string value",
+			"[[mappings]]\nfrom = \"a\"\nto = \"b\"\nvalues = { x = 1 }\n",
+			nil,
+			"invalid config: mappings[1]: values.x is not a string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tree, err := toml.Load(tc.toml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config{tree}
+			got, err := cfg.GetFieldMappings()
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("cfg.GetFieldMappings() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("cfg.GetFieldMappings() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetHumanizeFields(t *testing.T) {
+	testCases := []struct {
+		name    string
+		toml    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			"none",
+			`format="compact"`,
+			nil,
+			"",
+		},
+		{
+			"fields",
+			`
+[humanizeFields]
+"myapp.elapsed" = "duration:ms"
+"*.size" = "bytes"
+myapp.started = "epoch"
+
+[humanizeFields.event]
+duration = "none"
+`,
+			map[string]string{
+				"myapp.elapsed":  "duration:ms",
+				"*.size":         "bytes",
+				"myapp.started":  "epoch",
+				"event.duration": "none",
+			},
+			"",
+		},
+		{
+			"not a table",
+			`humanizeFields = "bytes"`,
+			nil,
+			"invalid config: 'humanizeFields' must be a table ([humanizeFields])",
+		},
+		{
+			"non-string value",
+			"[humanizeFields]\nmyapp.elapsed = 1\n",
+			nil,
+			"invalid config: humanizeFields.myapp.elapsed is not a string",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tree, err := toml.Load(tc.toml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config{tree}
+			got, err := cfg.GetHumanizeFields()
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("cfg.GetHumanizeFields() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("cfg.GetHumanizeFields() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetFormat(t *testing.T) {
+	formats := `
+[formats.base]
+inherit = "compact"
+excludeFields = ["process", "host"]
+level = "info"
+colorScheme = "default"
+
+[formats.trent]
+inherit = "base"
+excludeFields = []
+titleFields = ["trace.id"]
+title = "${log.level} ${message}"
+`
+	testCases := []struct {
+		name    string
+		toml    string
+		format  string
+		want    *format
+		wantErr string
+	}{
+		{
+			"built-in format",
+			`format="compact"`,
+			"simple",
+			&format{base: "simple"},
+			"",
+		},
+		{
+			"unknown format",
+			"[formats.b]\n[formats.a]\n",
+			"bogus",
+			nil,
+			"unknown format 'bogus' (known formats: compact, default, ecs, simple, a, b)",
+		},
+		{
+			"user-defined format",
+			formats,
+			"base",
+			&format{base: "compact", excludeFields: []string{"process", "host"}, level: "info", colorScheme: "default"},
+			"",
+		},
+		{
+			"inherited settings",
+			formats,
+			"trent",
+			&format{base: "compact", excludeFields: []string{}, titleFields: []string{"trace.id"}, title: "${log.level} ${message}", level: "info", colorScheme: "default"},
+			"",
+		},
+		{
+			"inherit from default",
+			"[formats.a]\nlevel = \"warn\"\n",
+			"a",
+			&format{base: "default", level: "warn"},
+			"",
+		},
+		{
+			"not a table of tables",
+			`formats = "compact"`,
+			"compact",
+			nil,
+			"invalid config: 'formats' must be a table of tables ([formats.NAME])",
+		},
+		{
+			"redefine built-in format",
+			"[formats.compact]\nlevel = \"warn\"\n",
+			"compact",
+			nil,
+			"invalid config: formats.compact: cannot redefine a built-in format",
+		},
+		{
+			"unknown key",
+			"[formats.a]\ntitleTemplate = \"${message}\"\n",
+			"a",
+			nil,
+			"invalid config: formats.a: unknown key 'titleTemplate' (known keys: inherit, excludeFields, includeFields, titleFields, title, colorScheme, level)",
+		},
+		{
+			"wrong type",
+			"[formats.a]\nexcludeFields = \"host\"\n",
+			"a",
+			nil,
+			"invalid config: formats.a: 'excludeFields' has the wrong type",
+		},
+		{
+			"unknown inherit",
+			"[formats.a]\ninherit = \"compakt\"\n",
+			"a",
+			nil,
+			"invalid config: formats.a: cannot inherit from unknown format 'compakt' (known formats: compact, default, ecs, simple, a)",
+		},
+		{
+			"inheritance cycle",
+			"[formats.a]\ninherit = \"b\"\n[formats.b]\ninherit = \"c\"\n[formats.c]\ninherit = \"a\"\n",
+			"compact",
+			nil,
+			"invalid config: formats.a: inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			"inherit from itself",
+			"[formats.a]\ninherit = \"a\"\n",
+			"a",
+			nil,
+			"invalid config: formats.a: inheritance cycle: a -> a",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tree, err := toml.Load(tc.toml)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := &config{tree}
+			got, err := cfg.GetFormat(tc.format)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Errorf("cfg.GetFormat(%q) error = %v, want %q", tc.format, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(format{})); diff != "" {
+				t.Errorf("cfg.GetFormat(%q) mismatch (-want +got):\n%s", tc.format, diff)
+			}
+		})
+	}
+}
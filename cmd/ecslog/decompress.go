@@ -0,0 +1,138 @@
+package main
+
+// Transparent decompression of compressed log inputs (e.g. rotated log files
+// like "app.log.1.gz").
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/trentm/go-ecslog/internal/lg"
+	"github.com/ulikunitz/xz"
+)
+
+// Leading "magic" bytes identifying compressed data formats.
+var (
+	magicGzip  = []byte{0x1f, 0x8b}
+	magicBzip2 = []byte("BZh") // followed by a block size digit, '1' to '9'
+	magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// The bzip2 magic bytes are printable, so a bzip2 stream is also identified
+// by the magic that follows them: that of the first block, or of the end of
+// the stream if it is empty.
+var (
+	magicBzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59} // "1AY&SY"
+	magicBzip2End   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+// maxMagicLen is the number of leading bytes needed to identify any of the
+// supported compression formats.
+const maxMagicLen = 10
+
+// compressionFromMagic returns the name of the compression format identified
+// by the given leading bytes of a stream, or the empty string if none.
+func compressionFromMagic(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, magicGzip):
+		return "gzip"
+	case isBzip2(head):
+		return "bzip2"
+	case bytes.HasPrefix(head, magicXz):
+		return "xz"
+	case bytes.HasPrefix(head, magicZstd):
+		return "zstd"
+	}
+	return ""
+}
+
+// isBzip2 returns true iff the given leading bytes of a stream are those of
+// a bzip2 stream.
+func isBzip2(head []byte) bool {
+	if len(head) < 10 || !bytes.HasPrefix(head, magicBzip2) || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	return bytes.HasPrefix(head[4:], magicBzip2Block) || bytes.HasPrefix(head[4:], magicBzip2End)
+}
+
+// decompressingReader returns a reader for the content of `in`, decompressing
+// it if it is compressed with gzip, bzip2, xz, or zstd. The format is detected
+// from the stream's leading magic bytes, not from a file extension.
+//
+// If `in` is not compressed and is seekable (e.g. a regular file), then `in`
+// itself is returned, so that it remains seekable.
+//
+// The caller should Close the returned reader. This does not close `in`.
+func decompressingReader(in io.Reader) (io.ReadCloser, error) {
+	var head []byte
+	var src io.Reader
+
+	seeker, seekable := in.(io.ReadSeeker)
+	if seekable {
+		// Seeking fails if, for example, os.Stdin is a pipe.
+		pos, err := seeker.Seek(0, io.SeekCurrent)
+		seekable = err == nil
+		if seekable {
+			head = make([]byte, maxMagicLen)
+			n, err := io.ReadFull(seeker, head)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+			head = head[:n]
+			if _, err = seeker.Seek(pos, io.SeekStart); err != nil {
+				return nil, err
+			}
+			src = seeker
+		}
+	}
+	if !seekable {
+		br := bufio.NewReader(in)
+		var err error
+		head, err = br.Peek(maxMagicLen)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		src = br
+	}
+
+	compression := compressionFromMagic(head)
+	if compression != "" {
+		lg.Printf("decompressing %s input\n", compression)
+	}
+	switch compression {
+	case "gzip":
+		return gzip.NewReader(src)
+	case "bzip2":
+		return ioutil.NopCloser(bzip2.NewReader(src)), nil
+	case "xz":
+		xr, err := xz.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(xr), nil
+	case "zstd":
+		zr, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	if seekable {
+		return nopSeekCloser{seeker}, nil
+	}
+	return ioutil.NopCloser(src), nil
+}
+
+// nopSeekCloser is an io.ReadSeeker with a no-op Close method. It is used
+// instead of ioutil.NopCloser to keep an uncompressed input seekable.
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error { return nil }
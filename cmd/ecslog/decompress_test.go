@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// onlyReader hides all but the Read method of a reader, e.g. to simulate
+// reading from a pipe on stdin.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestDecompressingReader(t *testing.T) {
+	want, err := ioutil.ReadFile("./testdata/strict.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCompressed := []byte(`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"hi from a compressed file"}` + "\n")
+
+	testCases := []struct {
+		path string
+		want []byte
+	}{
+		{"./testdata/strict.log", want},
+		{"./testdata/compressed.log.gz", wantCompressed},
+		{"./testdata/compressed.log.bz2", wantCompressed},
+		{"./testdata/compressed.log.xz", wantCompressed},
+		{"./testdata/compressed.log.zst", wantCompressed},
+		{"./testdata/gzip-without-extension", wantCompressed},
+		{"./testdata/bzh-prefix.log", []byte("BZh is my favourite prefix\n")},
+	}
+	for _, tc := range testCases {
+		for _, seekable := range []bool{true, false} {
+			f, err := os.Open(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var in io.Reader = f
+			if !seekable {
+				in = onlyReader{f}
+			}
+			rc, err := decompressingReader(in)
+			if err != nil {
+				t.Errorf("decompressingReader(%q) error: %s", tc.path, err)
+				f.Close()
+				continue
+			}
+			got, err := ioutil.ReadAll(rc)
+			if err != nil {
+				t.Errorf("decompressingReader(%q) read error: %s", tc.path, err)
+			} else if !bytes.Equal(got, tc.want) {
+				t.Errorf("decompressingReader(%q) (seekable=%v):\nwant: %q\ngot:  %q",
+					tc.path, seekable, tc.want, got)
+			}
+			if _, isSeeker := rc.(io.Seeker); seekable && tc.path == "./testdata/strict.log" && !isSeeker {
+				t.Errorf("decompressingReader(%q) did not keep an uncompressed file seekable", tc.path)
+			}
+			rc.Close()
+			f.Close()
+		}
+	}
+}
+
+func TestDecompressingReaderEmpty(t *testing.T) {
+	rc, err := decompressingReader(onlyReader{bytes.NewReader(nil)})
+	if err != nil {
+		t.Fatalf("decompressingReader(empty) error: %s", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	if err != nil || len(got) != 0 {
+		t.Errorf("decompressingReader(empty): got %q, %v", got, err)
+	}
+}
@@ -5,13 +5,17 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"regexp"
+	"time"
 
 	"github.com/mitchellh/go-wordwrap"
 	"github.com/spf13/pflag"
 
 	"github.com/trentm/go-ecslog/internal/ecslog"
+	"github.com/trentm/go-ecslog/internal/ingest"
 )
 
 // .goreleaser.yml ldflags
@@ -32,14 +36,74 @@ var flagKQL = flags.StringP("kql", "k", "",
 	`Filter log records with the given KQL query.
 E.g.: 'url.path:/foo and request.method:post'
 www.elastic.co/guide/en/kibana/current/kuery-query.html`)
+var flagSince = flags.String("since", "",
+	`Filter out log records before the given time. This can
+be an RFC 3339 time, a date, a time of day, or a
+duration ago, e.g.: '2021-01-19T22:51:00Z', '14:02',
+'15m', '2h'.`)
+var flagUntil = flags.String("until", "",
+	`Filter out log records after the given time. Accepts
+the same values as '--since'.`)
+var flagAfterContext = flags.IntP("after-context", "A", 0,
+	`Render N lines of context after each log record that
+matches '--level' or '--kql'.`)
+var flagBeforeContext = flags.IntP("before-context", "B", 0,
+	`Render N lines of context before each log record that
+matches '--level' or '--kql'.`)
+var flagContext = flags.IntP("context", "C", 0,
+	`Render N lines of context before and after each log
+record that matches '--level' or '--kql'.`)
+var flagHead = flags.Int("head", 0,
+	`Only render the first N log records of each input,
+counted after filtering.`)
+var flagTail = flags.Int("tail", 0,
+	`Only render the last N log records of each input,
+counted after filtering. With '--follow', start with
+the last N records and keep following.`)
 var flagStrict = flags.Bool("strict", false,
 	`Suppress all but legal ECS log lines. By default
 non-JSON and non-ecs-logging lines are passed through.`)
 
+// Input options.
+var flagFollow = flags.BoolP("follow", "F", false,
+	`Keep reading the given log files as they grow. Files
+that are rotated or truncated are re-opened. With more
+than one file, each output line is prefixed with its
+file name.`)
+var flagMerge = flags.BoolP("merge", "m", false,
+	`Merge records from multiple log files in @timestamp
+order. Each output line is prefixed with its file name.`)
+var flagJobs = flags.IntP("jobs", "j", 1,
+	`Number of goroutines with which to parse, filter, and
+format lines. Output order is preserved. This can speed
+up rendering large log files on multi-core machines.
+Cannot be used with --follow or --merge.`)
+var flagInputFormat = flags.String("input-format", "auto",
+	`Format of JSON log records in the input: 'auto' to
+detect the format of each record, 'ecs', 'bunyan',
+'pino', 'zap', 'logrus', or 'slog'. Other formats are
+converted to ECS fields.`)
+var flagMultilineJSON = flags.Bool("multiline-json", false,
+	`Recognize JSON records that are pretty-printed over
+multiple lines, e.g. from tools or test fixtures.`)
+var flagGroupLines = flags.Bool("group-lines", false,
+	`Group non-JSON lines that follow a record (e.g. a
+stack trace) with that record. They are filtered with
+the record and rendered indented beneath it.`)
+var flagPipeline = flags.String("pipeline", "",
+	`Process each record with the Elasticsearch ingest
+pipeline definition (JSON) in FILE, e.g. to grok-parse
+plain-text lines. Only some processors are supported.`)
+var flagPrefixRegex = flags.String("prefix-regex", "",
+	`A regex for a prefix to strip from log lines before
+the JSON record. Named capture groups can be used in
+KQL filters. E.g.: '(?P<host>\S+): '`)
+
 // Formatting options.
 var flagFormatName = flags.StringP("format", "f", "",
 	`Output format for rendered ECS log records.
-Valid formats are: 'default', 'compact', 'ecs', and 'simple'.`)
+Valid formats are: 'default', 'compact', 'ecs', and 'simple',
+or a format defined in the config file.`)
 var flagColor = flags.Bool("color", false,
 	`Colorize output. Without this option, coloring will be
 done if stdout is a TTY.`)
@@ -50,6 +114,21 @@ var flagExcludeFields = flags.StringP("exclude-fields", "x", "",
 	"Comma-separated list of fields to exclude from the output.")
 var flagIncludeFields = flags.StringP("include-fields", "i", "",
 	"Comma-separated list of fields to include in the output.")
+var flagTitle = flags.StringP("title", "t", "",
+	`Template for the title line of the 'default' and
+'compact' formats, e.g. '${@timestamp} ${message}'.
+See the README for the template syntax.`)
+var flagTitleFields = flags.String("title-fields", "",
+	`Comma-separated list of fields to render on the title
+line as 'key:value', e.g. 'trace.id,url.path'.`)
+var flagHumanize = flags.Bool("humanize", false,
+	`Render some number fields in human-readable form
+beside their value, e.g. 'event.duration' as '10.23s',
+'*.bytes' as '1.4 MiB', and epoch times as dates.`)
+var flagRenderJSON = flags.Bool("render-json", false,
+	`Render JSON lines that are not ecs-logging records,
+rather than passing them through. These are marked as
+"[non-ECS]" and are also filtered by '--kql'.`)
 
 func printError(msg string) {
 	fmt.Fprintf(os.Stderr, "ecslog: error: %s\n", msg)
@@ -121,6 +200,34 @@ func main() {
 	if cfgColor, ok := cfg.GetString("color"); ok {
 		shouldColorize = cfgColor
 	}
+	if *flagFollow && *flagMerge {
+		printError("cannot specify both --follow and --merge")
+		printUsage()
+		os.Exit(1)
+	}
+	if *flagHead < 0 || *flagTail < 0 {
+		printError("--head and --tail must not be negative")
+		printUsage()
+		os.Exit(1)
+	} else if *flagHead > 0 && *flagTail > 0 {
+		printError("cannot specify both --head and --tail")
+		printUsage()
+		os.Exit(1)
+	}
+	if *flagJobs < 1 {
+		printError("--jobs must be at least 1")
+		printUsage()
+		os.Exit(1)
+	} else if *flagJobs > 1 && (*flagFollow || *flagMerge) {
+		printError("cannot specify --jobs with --follow or --merge")
+		printUsage()
+		os.Exit(1)
+	}
+	if *flagAfterContext < 0 || *flagBeforeContext < 0 || *flagContext < 0 {
+		printError("-A, -B, and -C must not be negative")
+		printUsage()
+		os.Exit(1)
+	}
 	if *flagColor && *flagNoColor {
 		printError("cannot specify both --color and --no-color")
 		printUsage()
@@ -138,6 +245,12 @@ func main() {
 	if *flagFormatName != "" {
 		formatName = *flagFormatName
 	}
+	// A user-defined format is a built-in format with other settings.
+	formatSettings, err := cfg.GetFormat(formatName)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
 
 	maxLineLen := -1
 	if cfgMaxLineLen, ok := cfg.GetInt("maxLineLen"); ok {
@@ -146,7 +259,17 @@ func main() {
 
 	commaSplitter := regexp.MustCompile(`\s*,\s*`)
 	excludeFields := commaSplitter.Split(*flagExcludeFields, -1)
+	if !flags.Changed("exclude-fields") && formatSettings.excludeFields != nil {
+		excludeFields = formatSettings.excludeFields
+	}
 	includeFields := commaSplitter.Split(*flagIncludeFields, -1)
+	if !flags.Changed("include-fields") && formatSettings.includeFields != nil {
+		includeFields = formatSettings.includeFields
+	}
+	colorScheme := *flagColorScheme
+	if !flags.Changed("color-scheme") && formatSettings.colorScheme != "" {
+		colorScheme = formatSettings.colorScheme
+	}
 
 	ecsLenient := false
 	if cfgECSLenient, ok := cfg.GetBool("ecsLenient"); ok {
@@ -160,8 +283,8 @@ func main() {
 
 	r, err := ecslog.NewRenderer(
 		shouldColorize,
-		*flagColorScheme,
-		formatName,
+		colorScheme,
+		formatSettings.base,
 		maxLineLen,
 		excludeFields,
 		includeFields,
@@ -173,17 +296,156 @@ func main() {
 		printUsage()
 		os.Exit(1)
 	}
-	r.SetLevelFilter(*flagLevel)
+	title := *flagTitle
+	if title == "" {
+		title = formatSettings.title
+	}
+	if title == "" {
+		title, _ = cfg.GetString("title")
+	}
+	err = r.SetTitleTemplate(title)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	titleFields := commaSplitter.Split(*flagTitleFields, -1)
+	if !flags.Changed("title-fields") {
+		if formatSettings.titleFields != nil {
+			titleFields = formatSettings.titleFields
+		} else if cfgTitleFields, ok := cfg.GetStringArray("titleFields"); ok {
+			titleFields = cfgTitleFields
+		}
+	}
+	r.SetTitleFields(titleFields)
+	humanize, _ := cfg.GetBool("humanize")
+	if flags.Changed("humanize") {
+		humanize = *flagHumanize
+	}
+	humanizeFields, err := cfg.GetHumanizeFields()
+	if err == nil {
+		err = r.SetHumanize(humanize, humanizeFields)
+	}
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	level := *flagLevel
+	if level == "" {
+		level = formatSettings.level
+	}
+	r.SetLevelFilter(level)
 	err = r.SetKQLFilter(*flagKQL)
 	if err != nil {
 		printError("invalid KQL: " + err.Error())
 		os.Exit(1)
 	}
 	r.SetStrictFilter(*flagStrict)
+	r.SetRenderJSON(*flagRenderJSON)
+	r.SetMultilineJSON(*flagMultilineJSON)
+	r.SetGroupLines(*flagGroupLines)
+	err = r.SetInputFormat(*flagInputFormat)
+	if err != nil {
+		printError(err.Error())
+		printUsage()
+		os.Exit(1)
+	}
+	mappings, err := cfg.GetFieldMappings()
+	if err == nil {
+		err = r.SetFieldMappings(mappings)
+	}
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	if *flagPipeline != "" {
+		data, err := ioutil.ReadFile(*flagPipeline)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		pipeline, err := ingest.Load(data)
+		if err != nil {
+			printError(fmt.Sprintf("%s: %s", *flagPipeline, err))
+			os.Exit(1)
+		}
+		r.SetPipeline(pipeline)
+	}
+	linePrefix := *flagPrefixRegex
+	if linePrefix == "" {
+		linePrefix, _ = cfg.GetString("linePrefix")
+	}
+	err = r.SetLinePrefixRegex(linePrefix)
+	if err != nil {
+		printError(err.Error())
+		os.Exit(1)
+	}
+	// As with grep, `-A N` and `-B N` override `-C N`.
+	beforeContext, afterContext := *flagContext, *flagContext
+	if flags.Changed("before-context") {
+		beforeContext = *flagBeforeContext
+	}
+	if flags.Changed("after-context") {
+		afterContext = *flagAfterContext
+	}
+	r.SetContext(beforeContext, afterContext)
+	r.SetWorkers(*flagJobs)
+
+	var since, until time.Time
+	now := time.Now()
+	if *flagSince != "" {
+		since, err = ecslog.ParseTimeBound(*flagSince, now)
+		if err != nil {
+			printError("invalid --since: " + err.Error())
+			os.Exit(1)
+		}
+	}
+	if *flagUntil != "" {
+		until, err = ecslog.ParseTimeBound(*flagUntil, now)
+		if err != nil {
+			printError("invalid --until: " + err.Error())
+			os.Exit(1)
+		}
+	}
+	r.SetTimeRangeFilter(since, until)
+	r.SetHeadLimit(*flagHead)
+	r.SetTailLimit(*flagTail)
 
 	if len(flags.Args()) == 0 {
-		f = os.Stdin
-		err = r.RenderFile(f, os.Stdout)
+		in, err := decompressingReader(os.Stdin)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stdin: %s", err))
+		} else {
+			err = r.RenderFile(in, os.Stdout)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			in.Close()
+		}
+	} else if *flagFollow {
+		err = r.FollowFiles(flags.Args(), os.Stdout, nil)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	} else if *flagMerge {
+		var ins []io.Reader
+		var names []string
+		for _, logPath := range flags.Args() {
+			f, err = os.Open(logPath)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			defer f.Close()
+			in, err := decompressingReader(f)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", logPath, err))
+				continue
+			}
+			defer in.Close()
+			ins = append(ins, in)
+			names = append(names, logPath)
+		}
+		err = r.RenderMerged(ins, names, os.Stdout)
 		if err != nil {
 			errs = append(errs, err)
 		}
@@ -194,10 +456,17 @@ func main() {
 				errs = append(errs, err)
 				continue
 			}
-			err = r.RenderFile(f, os.Stdout)
+			in, err := decompressingReader(f)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", logPath, err))
+				f.Close()
+				continue
+			}
+			err = r.RenderFile(in, os.Stdout)
 			if err != nil {
 				errs = append(errs, err)
 			}
+			in.Close()
 			f.Close()
 		}
 	}
@@ -74,6 +74,52 @@ var mainTestCases = []mainTestCase{
 		nil,
 	},
 
+	{
+		"ecslog --follow --merge",
+		[]string{"ecslog", "--no-config", "--follow", "--merge", "./testdata/strict.log"},
+		1,
+		nil,
+		regexp.MustCompile(`cannot specify both --follow and --merge`),
+	},
+
+	// Compressed log files are transparently decompressed.
+	{
+		"ecslog compressed.log.gz",
+		[]string{"ecslog", "--no-config", "./testdata/compressed.log.gz"},
+		0,
+		regexp.MustCompile(`^\[2021-01-19T22:51:12.142Z\]  INFO: hi from a compressed file\n$`),
+		nil,
+	},
+	{
+		"ecslog compressed.log.bz2",
+		[]string{"ecslog", "--no-config", "./testdata/compressed.log.bz2"},
+		0,
+		regexp.MustCompile(`^\[2021-01-19T22:51:12.142Z\]  INFO: hi from a compressed file\n$`),
+		nil,
+	},
+	{
+		"ecslog compressed.log.xz",
+		[]string{"ecslog", "--no-config", "./testdata/compressed.log.xz"},
+		0,
+		regexp.MustCompile(`^\[2021-01-19T22:51:12.142Z\]  INFO: hi from a compressed file\n$`),
+		nil,
+	},
+	{
+		"ecslog compressed.log.zst",
+		[]string{"ecslog", "--no-config", "./testdata/compressed.log.zst"},
+		0,
+		regexp.MustCompile(`^\[2021-01-19T22:51:12.142Z\]  INFO: hi from a compressed file\n$`),
+		nil,
+	},
+	{
+		// Compression is detected from the content, not the file extension.
+		"ecslog gzip-without-extension",
+		[]string{"ecslog", "--no-config", "./testdata/gzip-without-extension"},
+		0,
+		regexp.MustCompile(`^\[2021-01-19T22:51:12.142Z\]  INFO: hi from a compressed file\n$`),
+		nil,
+	},
+
 	// Test rendering of -x,--exclude-fields option
 	{
 		"ecslog --exclude-fields foo,spam",
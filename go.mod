@@ -4,9 +4,11 @@ go 1.14
 
 require (
 	github.com/google/go-cmp v0.5.5
+	github.com/klauspost/compress v1.13.6
 	github.com/mattn/go-isatty v0.0.12
 	github.com/mitchellh/go-wordwrap v1.0.1
 	github.com/pelletier/go-toml v1.8.1
 	github.com/spf13/pflag v1.0.5
+	github.com/ulikunitz/xz v0.5.10
 	github.com/valyala/fastjson v1.6.3
 )
@@ -159,6 +159,7 @@ var BunyanPainter = New(map[string][]Attribute{
 	"warn":    {FgMagenta},
 	"error":   {FgRed},
 	"fatal":   {ReverseVideo},
+	"context": {Faint},
 })
 
 // PinoPrettyPainter styles rendered output the same as `pino-pretty`.
@@ -170,6 +171,7 @@ var PinoPrettyPainter = New(map[string][]Attribute{
 	"warn":    {FgYellow},
 	"error":   {FgRed},
 	"fatal":   {BgRed},
+	"context": {Faint},
 })
 
 // DefaultPainter implements the stock default color scheme for `ecslog`.
@@ -191,6 +193,10 @@ var DefaultPainter = New(map[string][]Attribute{
 	"jsonFalse":     {Italic, FgRed},
 	"jsonNull":      {Italic, Bold, FgBlack},
 	"ellipsis":      {Faint},
+	"source":        {FgMagenta},
+	"nonECS":        {Faint},
+	"context":       {Faint},
+	"humanized":     {Faint},
 	// log.level names (see ecslog.go#levelValFromName for known names)
 	"trace":       {FgHiBlack},
 	"debug":       {FgHiBlue},
@@ -0,0 +1,102 @@
+package ecslog
+
+// Support for rendering web server access log lines in Common Log Format or
+// Combined Log Format (as used by Apache httpd and nginx), e.g.:
+//
+//    127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// accessLogRe matches a Common or Combined Log Format line. Any fields after
+// the combined format fields (e.g. nginx's "$http_x_forwarded_for") are
+// ignored.
+var accessLogRe = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)` +
+	`(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?(?:\s|$)`)
+
+// parseAccessLog parses a Common or Combined Log Format line into a record
+// with ECS fields. It returns nil if the line is not in one of these formats.
+//
+// The record's "message" is the request line, e.g. "GET / HTTP/1.1", and its
+// "log.level" is "error" for 5xx responses, "warn" for 4xx responses, and
+// "info" otherwise.
+func (r *Renderer) parseAccessLog(line []byte) *fastjson.Value {
+	// Quickly rule out most other lines before using the regexp.
+	if bytes.Index(line, []byte(`] "`)) == -1 {
+		return nil
+	}
+	m := accessLogRe.FindSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m[3]))
+	if err != nil {
+		return nil
+	}
+	a := &r.arena
+	a.Reset()
+	rec := a.NewObject()
+	rec.Set("@timestamp", a.NewString(t.Format("2006-01-02T15:04:05Z07:00")))
+	level := "info"
+	if m[5][0] == '5' {
+		level = "error"
+	} else if m[5][0] == '4' {
+		level = "warn"
+	}
+	rec.Set("log.level", a.NewString(level))
+	rec.Set("ecs.version", a.NewString(adaptedECSVersion))
+	rec.Set("message", a.NewStringBytes(m[4]))
+
+	source := a.NewObject()
+	if net.ParseIP(string(m[1])) != nil {
+		source.Set("ip", a.NewStringBytes(m[1]))
+	} else {
+		source.Set("address", a.NewStringBytes(m[1]))
+	}
+	rec.Set("source", source)
+	if user := string(m[2]); user != "-" {
+		u := a.NewObject()
+		u.Set("name", a.NewString(user))
+		rec.Set("user", u)
+	}
+
+	httpObj := a.NewObject()
+	request := a.NewObject()
+	// The request line is "METHOD URL PROTOCOL", e.g. "GET / HTTP/1.1".
+	if parts := strings.Split(string(m[4]), " "); len(parts) == 3 && strings.HasPrefix(parts[2], "HTTP/") {
+		request.Set("method", a.NewString(parts[0]))
+		u := a.NewObject()
+		u.Set("original", a.NewString(parts[1]))
+		rec.Set("url", u)
+		httpObj.Set("version", a.NewString(strings.TrimPrefix(parts[2], "HTTP/")))
+	}
+	if len(m[7]) > 0 && string(m[7]) != "-" {
+		request.Set("referrer", a.NewStringBytes(m[7]))
+	}
+	if request.GetObject().Len() > 0 {
+		httpObj.Set("request", request)
+	}
+	response := a.NewObject()
+	response.Set("status_code", a.NewNumberString(string(m[5])))
+	if bytes := string(m[6]); bytes != "-" {
+		body := a.NewObject()
+		body.Set("bytes", a.NewNumberString(bytes))
+		response.Set("body", body)
+	}
+	httpObj.Set("response", response)
+	rec.Set("http", httpObj)
+
+	if len(m[8]) > 0 && string(m[8]) != "-" {
+		ua := a.NewObject()
+		ua.Set("original", a.NewStringBytes(m[8]))
+		rec.Set("user_agent", ua)
+	}
+	return rec
+}
@@ -0,0 +1,116 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestAccessLog(t *testing.T) {
+	combined := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif?a=b HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+	testCases := []struct {
+		name       string
+		formatName string
+		kql        string
+		input      string
+		want       string
+	}{
+		{
+			"combined",
+			"ecs", "",
+			combined,
+			`{"@timestamp":"2000-10-10T13:55:36-07:00","log.level":"info","ecs.version":"1.6.0","message":"GET /apache_pb.gif?a=b HTTP/1.0",` +
+				`"source":{"ip":"127.0.0.1"},"user":{"name":"frank"},"url":{"original":"/apache_pb.gif?a=b"},` +
+				`"http":{"version":"1.0","request":{"method":"GET","referrer":"http://www.example.com/start.html"},"response":{"status_code":200,"body":{"bytes":2326}}},` +
+				`"user_agent":{"original":"Mozilla/4.08 [en] (Win98; I ;Nav)"}}` + "\n",
+		},
+		{
+			"common with nginx extra fields",
+			"ecs", "",
+			`web-1.internal - - [19/Jan/2021:22:51:12 +0000] "POST /api HTTP/1.1" 503 - "-" "-" "10.0.0.1"`,
+			`{"@timestamp":"2021-01-19T22:51:12Z","log.level":"error","ecs.version":"1.6.0","message":"POST /api HTTP/1.1",` +
+				`"source":{"address":"web-1.internal"},"url":{"original":"/api"},` +
+				`"http":{"version":"1.1","request":{"method":"POST"},"response":{"status_code":503}}}` + "\n",
+		},
+		{
+			"invalid request line",
+			"ecs", "",
+			`::1 - - [19/Jan/2021:22:51:12 +0000] "\x16\x03\x01" 400 157`,
+			`{"@timestamp":"2021-01-19T22:51:12Z","log.level":"warn","ecs.version":"1.6.0","message":"\\x16\\x03\\x01",` +
+				`"source":{"ip":"::1"},"http":{"response":{"status_code":400,"body":{"bytes":157}}}}` + "\n",
+		},
+		{
+			"default format",
+			"default", "",
+			combined,
+			`[2000-10-10T13:55:36-07:00]  INFO: GET /apache_pb.gif?a=b HTTP/1.0
+    source: {
+        "ip": "127.0.0.1"
+    }
+    user: {
+        "name": "frank"
+    }
+    http: {
+        "request": {
+            "referrer": "http://www.example.com/start.html"
+        }
+    }
+    user_agent: {
+        "original": "Mozilla/4.08 [en] (Win98; I ;Nav)"
+    }
+    --
+    HTTP/1.0 200 OK
+    Content-Length: 2326
+`,
+		},
+		{
+			"compact format without other request fields",
+			"compact", "",
+			`web-1.internal - - [19/Jan/2021:22:51:12 +0000] "POST /api HTTP/1.1" 503 -`,
+			"[2021-01-19T22:51:12Z] ERROR: POST /api HTTP/1.1\n" +
+				"    source: {\"address\": \"web-1.internal\"}\n" +
+				"    --\n" +
+				"    HTTP/1.1 503 Service Unavailable\n",
+		},
+		{
+			"kql filter alongside ecs records",
+			"simple", "http.response.status_code >= 500 or log.level:info",
+			`10.0.0.1 - - [19/Jan/2021:22:51:12 +0000] "GET / HTTP/1.1" 200 12
+{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"app"}
+10.0.0.2 - - [19/Jan/2021:22:51:13 +0000] "GET /boom HTTP/1.1" 502 0
+10.0.0.3 - - [19/Jan/2021:22:51:14 +0000] "GET /missing HTTP/1.1" 404 0`,
+			" INFO: GET / HTTP/1.1 …\n INFO: app\nERROR: GET /boom HTTP/1.1 …\n",
+		},
+		{
+			"not access log lines",
+			"simple", "",
+			`10.0.0.1 - - [19/Jan/2021 22:51:12] "GET / HTTP/1.1" 200 12
+10.0.0.1 - - [19/Jan/2021:22:51:12 +0000] "GET / HTTP/1.1" 2000 12
+10.0.0.1 - - [19/Jan/2021:22:51:12 +0000] "GET / HTTP/1.1" 200 12kb`,
+			`10.0.0.1 - - [19/Jan/2021 22:51:12] "GET / HTTP/1.1" 200 12
+10.0.0.1 - - [19/Jan/2021:22:51:12 +0000] "GET / HTTP/1.1" 2000 12
+10.0.0.1 - - [19/Jan/2021:22:51:12 +0000] "GET / HTTP/1.1" 200 12kb
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package ecslog
+
+// Support for rendering JSON log records from other logging libraries (e.g.
+// Bunyan, pino, and zap) by converting them to ecs-logging records.
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// adaptedECSVersion is the "ecs.version" of records converted or synthesized
+// from other log formats.
+const adaptedECSVersion = "1.6.0"
+
+// recordAdapter converts records in another JSON log format to ecs-logging
+// records.
+type recordAdapter struct {
+	// detect returns true if the record looks like it is in this format.
+	detect func(rec *fastjson.Value) bool
+	// adapt moves the record's fields to their ECS equivalents, in place.
+	adapt func(r *Renderer, rec *fastjson.Value)
+}
+
+// Bunyan records: https://github.com/trentm/node-bunyan#core-fields
+var bunyanAdapter = &recordAdapter{
+	detect: func(rec *fastjson.Value) bool {
+		return isType(rec.Get("v"), fastjson.TypeNumber) &&
+			isType(rec.Get("level"), fastjson.TypeNumber) &&
+			isType(rec.Get("time"), fastjson.TypeString)
+	},
+	adapt: func(r *Renderer, rec *fastjson.Value) {
+		adaptNodeRecord(r, rec)
+	},
+}
+
+// pino records: https://getpino.io/#/docs/api?id=logger
+var pinoAdapter = &recordAdapter{
+	detect: func(rec *fastjson.Value) bool {
+		return isType(rec.Get("level"), fastjson.TypeNumber) &&
+			isType(rec.Get("time"), fastjson.TypeNumber)
+	},
+	adapt: func(r *Renderer, rec *fastjson.Value) {
+		adaptEpochTime(r, rec, "time", time.Millisecond)
+		adaptNodeRecord(r, rec)
+	},
+}
+
+// zap records from the default production JSON encoder:
+// https://pkg.go.dev/go.uber.org/zap#NewProductionEncoderConfig
+// This also handles go-kit/log records (used by Prometheus tools), which have
+// an RFC 3339 "ts".
+var zapAdapter = &recordAdapter{
+	detect: func(rec *fastjson.Value) bool {
+		ts := rec.Get("ts")
+		return isType(rec.Get("level"), fastjson.TypeString) &&
+			(isType(ts, fastjson.TypeNumber) || isType(ts, fastjson.TypeString))
+	},
+	adapt: func(r *Renderer, rec *fastjson.Value) {
+		adaptEpochTime(r, rec, "ts", time.Second)
+		renameField(rec, "level", "log.level")
+		renameField(rec, "ts", "@timestamp")
+		renameField(rec, "logger", "log.logger")
+		renameField(rec, "msg", "message")
+		if caller := rec.Get("caller"); isType(caller, fastjson.TypeString) {
+			file, line := splitFileLine(string(caller.GetStringBytes()))
+			if adaptLogOrigin(r, rec, "", file, line) {
+				rec.Del("caller")
+			}
+		}
+		renameField(rec, "stacktrace", "error.stack_trace")
+		adaptErrorString(rec, "error")
+	},
+}
+
+// slogLevelRe matches the level names of Go's log/slog package, including
+// levels in between, e.g. "INFO+2".
+var slogLevelRe = regexp.MustCompile(`^(DEBUG|INFO|WARN|ERROR)([+-]\d+)?$`)
+
+// Go log/slog records from slog.JSONHandler:
+// https://pkg.go.dev/log/slog#JSONHandler
+var slogAdapter = &recordAdapter{
+	detect: func(rec *fastjson.Value) bool {
+		level := rec.Get("level")
+		return isType(rec.Get("time"), fastjson.TypeString) &&
+			isType(level, fastjson.TypeString) &&
+			slogLevelRe.Match(level.GetStringBytes())
+	},
+	adapt: func(r *Renderer, rec *fastjson.Value) {
+		if level := rec.Get("level"); isType(level, fastjson.TypeString) {
+			if m := slogLevelRe.FindSubmatch(level.GetStringBytes()); m != nil {
+				rec.Set("level", r.arena.NewString(strings.ToLower(string(m[1]))))
+			}
+		}
+		renameField(rec, "level", "log.level")
+		renameField(rec, "time", "@timestamp")
+		renameField(rec, "msg", "message")
+		if source := rec.Get("source"); isType(source, fastjson.TypeObject) {
+			var line string
+			if l := source.Get("line"); isType(l, fastjson.TypeNumber) {
+				line = l.String()
+			}
+			if adaptLogOrigin(r, rec, string(source.GetStringBytes("function")),
+				string(source.GetStringBytes("file")), line) {
+				rec.Del("source")
+			}
+		}
+	},
+}
+
+// logrus records from logrus.JSONFormatter:
+// https://pkg.go.dev/github.com/sirupsen/logrus#JSONFormatter
+var logrusAdapter = &recordAdapter{
+	detect: func(rec *fastjson.Value) bool {
+		return isType(rec.Get("time"), fastjson.TypeString) &&
+			isType(rec.Get("level"), fastjson.TypeString) &&
+			isType(rec.Get("msg"), fastjson.TypeString)
+	},
+	adapt: func(r *Renderer, rec *fastjson.Value) {
+		renameField(rec, "level", "log.level")
+		renameField(rec, "time", "@timestamp")
+		renameField(rec, "msg", "message")
+		// With `SetReportCaller(true)`, "func" is the function name and
+		// "file" is "path/to/file.go:line".
+		fn := rec.Get("func")
+		fileLine := rec.Get("file")
+		if isType(fn, fastjson.TypeString) || isType(fileLine, fastjson.TypeString) {
+			file, line := splitFileLine(string(fileLine.GetStringBytes()))
+			if adaptLogOrigin(r, rec, string(fn.GetStringBytes()), file, line) {
+				rec.Del("func")
+				rec.Del("file")
+			}
+		}
+		adaptErrorString(rec, "error")
+	},
+}
+
+var adapterFromName = map[string]*recordAdapter{
+	"bunyan": bunyanAdapter,
+	"pino":   pinoAdapter,
+	"zap":    zapAdapter,
+	"slog":   slogAdapter,
+	"logrus": logrusAdapter,
+}
+
+// autoAdapters are the adapters tried, in order, to detect the format of
+// each record with the "auto" input format.
+var autoAdapters = []*recordAdapter{
+	bunyanAdapter,
+	pinoAdapter,
+	zapAdapter,
+	slogAdapter,
+	logrusAdapter,
+}
+
+// SetInputFormat sets the format of JSON log records in the input. It is one
+// of "auto" (the default) to detect the format of each record, "ecs" to only
+// render ecs-logging records, or the name of another log format (e.g.
+// "bunyan") whose records are converted to ecs-logging records before
+// filtering and formatting.
+func (r *Renderer) SetInputFormat(name string) error {
+	switch name {
+	case "", "auto":
+		r.inputAdapter = nil
+		r.autoAdapt = true
+	case "ecs":
+		r.inputAdapter = nil
+		r.autoAdapt = false
+	default:
+		a, ok := adapterFromName[name]
+		if !ok {
+			known := []string{"auto", "ecs"}
+			for n := range adapterFromName {
+				known = append(known, n)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown input format '%s' (known input formats: %s)",
+				name, strings.Join(known, ", "))
+		}
+		r.inputAdapter = a
+		r.autoAdapt = false
+	}
+	return nil
+}
+
+// adaptRecord converts the record to an ecs-logging record if it is in
+// another log format (see SetInputFormat). It returns true if the record was
+// converted.
+func (r *Renderer) adaptRecord(rec *fastjson.Value) bool {
+	a := r.inputAdapter
+	if a == nil && r.autoAdapt {
+		for _, aa := range autoAdapters {
+			if aa.detect(rec) {
+				a = aa
+				break
+			}
+		}
+	}
+	if a == nil {
+		return false
+	}
+	a.adapt(r, rec)
+	if jsonutils.LookupValue(rec, "ecs", "version") == nil {
+		rec.Set("ecs.version", r.arena.NewString(adaptedECSVersion))
+	}
+	return true
+}
+
+func isType(v *fastjson.Value, typ fastjson.Type) bool {
+	return v != nil && v.Type() == typ
+}
+
+// renameField moves the top-level field `from` of the record to the dotted
+// field name `to`, unless the record already has a `to` field.
+func renameField(rec *fastjson.Value, from, to string) {
+	v := rec.Get(from)
+	if v == nil {
+		return
+	}
+	lookup := strings.Split(to, ".")
+	if jsonutils.LookupValue(rec, lookup...) != nil {
+		return
+	}
+	rec.Del(from)
+	jsonutils.SetValue(rec, v, lookup...)
+}
+
+// levelNameFromNumber returns the level name for a numeric level, as used by
+// Bunyan and pino: 10 is "trace", 20 "debug", ..., 60 "fatal". Levels between
+// these get the name of the next lower level.
+func levelNameFromNumber(n float64) string {
+	switch {
+	case n < 20:
+		return "trace"
+	case n < 30:
+		return "debug"
+	case n < 40:
+		return "info"
+	case n < 50:
+		return "warn"
+	case n < 60:
+		return "error"
+	default:
+		return "fatal"
+	}
+}
+
+// adaptEpochTime replaces a top-level field that is a number of `unit`s
+// (e.g. seconds) since the epoch with an RFC 3339 time string.
+func adaptEpochTime(r *Renderer, rec *fastjson.Value, key string, unit time.Duration) {
+	v := rec.Get(key)
+	if !isType(v, fastjson.TypeNumber) {
+		return
+	}
+	// Round to microseconds, because a float number of seconds, e.g.
+	// 1611096672.142, is not exact.
+	usec := math.Round(v.GetFloat64() * float64(unit/time.Microsecond))
+	t := time.Unix(0, int64(usec)*int64(time.Microsecond)).UTC()
+	rec.Set(key, r.arena.NewString(t.Format("2006-01-02T15:04:05.000Z07:00")))
+}
+
+// splitFileLine splits a "file:line" string, e.g. "server/main.go:42", into
+// its file and line. The line is empty if there is none.
+func splitFileLine(s string) (file, line string) {
+	if i := strings.LastIndexByte(s, ':'); i != -1 {
+		if _, err := strconv.Atoi(s[i+1:]); err == nil {
+			return s[:i], s[i+1:]
+		}
+	}
+	return s, ""
+}
+
+// adaptLogOrigin sets "log.origin" to the given function name, file name, and
+// line number, any of which may be empty. It returns false, leaving the
+// record unchanged, if all are empty or the record already has "log.origin".
+func adaptLogOrigin(r *Renderer, rec *fastjson.Value, function, file, line string) bool {
+	if function == "" && file == "" && line == "" {
+		return false
+	}
+	if jsonutils.LookupValue(rec, "log", "origin") != nil {
+		return false
+	}
+	origin := r.arena.NewObject()
+	if file != "" || line != "" {
+		f := r.arena.NewObject()
+		if file != "" {
+			f.Set("name", r.arena.NewString(file))
+		}
+		if line != "" {
+			f.Set("line", r.arena.NewNumberString(line))
+		}
+		origin.Set("file", f)
+	}
+	if function != "" {
+		origin.Set("function", r.arena.NewString(function))
+	}
+	jsonutils.SetValue(rec, origin, "log", "origin")
+	return true
+}
+
+// adaptErrorString moves a top-level string error field, e.g. `"error":"EOF"`
+// from zap's `zap.Error(err)`, to "error.message".
+func adaptErrorString(rec *fastjson.Value, key string) {
+	if isType(rec.Get(key), fastjson.TypeString) {
+		renameField(rec, key, "error.message")
+	}
+}
+
+// adaptNodeRecord moves the fields common to Bunyan and pino records to their
+// ECS equivalents.
+func adaptNodeRecord(r *Renderer, rec *fastjson.Value) {
+	if level := rec.Get("level"); isType(level, fastjson.TypeNumber) {
+		rec.Set("level", r.arena.NewString(levelNameFromNumber(level.GetFloat64())))
+	}
+	renameField(rec, "level", "log.level")
+	renameField(rec, "time", "@timestamp")
+	renameField(rec, "msg", "message")
+	renameField(rec, "name", "service.name")
+	renameField(rec, "hostname", "host.hostname")
+	renameField(rec, "pid", "process.pid")
+	rec.Del("v")
+
+	// Bunyan serializes errors as {message, name, stack, code, signal}, and
+	// pino as {type, message, stack, ...}.
+	if err := rec.Get("err"); isType(err, fastjson.TypeObject) {
+		for _, m := range [][2]string{
+			{"message", "error.message"},
+			{"name", "error.type"},
+			{"type", "error.type"},
+			{"stack", "error.stack_trace"},
+			{"code", "error.code"},
+		} {
+			if v := err.Get(m[0]); v != nil && jsonutils.LookupValue(rec, strings.Split(m[1], ".")...) == nil {
+				err.Del(m[0])
+				jsonutils.SetValue(rec, v, strings.Split(m[1], ".")...)
+			}
+		}
+		if err.GetObject().Len() == 0 {
+			rec.Del("err")
+		}
+	}
+}
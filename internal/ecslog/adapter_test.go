@@ -0,0 +1,163 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestInputFormats(t *testing.T) {
+	bunyanRec := `{"name":"api","hostname":"web1","pid":1234,"level":30,"msg":"hi","time":"2021-01-19T22:51:12.142Z","v":0}`
+	bunyanErr := `{"name":"api","hostname":"web1","pid":1234,"level":50,"err":{"message":"boom","name":"Error","stack":"Error: boom\n    at foo (foo.js:1:2)"},"msg":"boom","time":"2021-01-19T22:51:12.142Z","v":0}`
+	pinoRec := `{"level":40,"time":1611096672142,"pid":1234,"hostname":"web1","msg":"careful","foo":"bar"}`
+	ecsRec := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"ecs"}`
+
+	testCases := []struct {
+		name        string
+		inputFormat string
+		formatName  string
+		level       string
+		kql         string
+		input       string
+		want        string
+	}{
+		{
+			"bunyan",
+			"", "default", "", "",
+			bunyanRec,
+			"[2021-01-19T22:51:12.142Z]  INFO (api on web1): hi\n    process.pid: 1234\n",
+		},
+		{
+			"bunyan err",
+			"", "default", "", "",
+			bunyanErr,
+			"[2021-01-19T22:51:12.142Z] ERROR (api on web1): boom\n" +
+				"    process.pid: 1234\n" +
+				"    error.message: \"boom\"\n" +
+				"    error.type: \"Error\"\n" +
+				"    error.stack_trace: \n" +
+				"        Error: boom\n" +
+				"            at foo (foo.js:1:2)\n",
+		},
+		{
+			"pino",
+			"", "default", "", "",
+			pinoRec,
+			"[2021-01-19T22:51:12.142Z]  WARN (on web1): careful\n    foo: \"bar\"\n    process.pid: 1234\n",
+		},
+		{
+			"mixed formats with auto",
+			"auto", "simple", "", "",
+			bunyanRec + "\n" + pinoRec + "\n" + ecsRec + "\n" + `{"level":"info","msg":"other"}`,
+			" INFO: hi …\n WARN: careful …\n INFO: ecs\n" + `{"level":"info","msg":"other"}` + "\n",
+		},
+		{
+			"level filter",
+			"", "simple", "warn", "",
+			bunyanRec + "\n" + bunyanErr + "\n" + pinoRec,
+			"ERROR: boom …\n WARN: careful …\n",
+		},
+		{
+			"kql filter",
+			"", "simple", "", "service.name:api and error.type:Error",
+			bunyanRec + "\n" + bunyanErr + "\n" + pinoRec,
+			"ERROR: boom …\n",
+		},
+		{
+			"ecs format renders converted record",
+			"", "ecs", "", "",
+			pinoRec,
+			`{"foo":"bar","log.level":"warn","@timestamp":"2021-01-19T22:51:12.142Z","message":"careful","host.hostname":"web1","process.pid":1234,"ecs.version":"1.6.0"}` + "\n",
+		},
+		{
+			"ecs input format",
+			"ecs", "simple", "", "",
+			bunyanRec + "\n" + ecsRec,
+			bunyanRec + "\n INFO: ecs\n",
+		},
+		{
+			"zap",
+			"", "default", "", "",
+			`{"level":"error","ts":1611096672.142,"logger":"db","caller":"store/db.go:42","msg":"query failed","error":"EOF","stacktrace":"main.main\n\t/app/main.go:12"}`,
+			"[2021-01-19T22:51:12.142Z] ERROR (db): query failed\n" +
+				"    log.origin: {\n" +
+				"        \"file\": {\n" +
+				"            \"name\": \"store/db.go\",\n" +
+				"            \"line\": 42\n" +
+				"        }\n" +
+				"    }\n" +
+				"    error.stack_trace: \n" +
+				"        main.main\n" +
+				"        \t/app/main.go:12\n" +
+				"    error.message: \"EOF\"\n",
+		},
+		{
+			"slog",
+			"", "compact", "", "",
+			`{"time":"2021-01-19T22:51:12.142+01:00","level":"WARN+2","source":{"function":"main.run","file":"main.go","line":7},"msg":"slow","ms":250}`,
+			"[2021-01-19T22:51:12.142+01:00]  WARN: slow\n" +
+				"    ms: 250\n" +
+				"    log.origin: {\"file\": {\"name\": \"main.go\", \"line\": 7}, \"function\": \"main.run\"}\n",
+		},
+		{
+			"logrus",
+			"", "compact", "", "",
+			`{"error":"not found","file":"main.go:20","func":"main.get","level":"warning","msg":"lookup failed","time":"2021-01-19T22:51:12Z"}`,
+			"[2021-01-19T22:51:12Z] WARNING: lookup failed\n" +
+				"    log.origin: {\"file\": {\"name\": \"main.go\", \"line\": 20}, \"function\": \"main.get\"}\n" +
+				"    error.message: \"not found\"\n",
+		},
+		{
+			"go formats with filters",
+			"", "simple", "warn", "log.origin.file.name:*main.go",
+			`{"level":"info","ts":1611096672.142,"caller":"app/main.go:1","msg":"zap info"}
+{"level":"warn","ts":1611096672.142,"caller":"app/main.go:2","msg":"zap warn"}
+{"level":"warn","ts":1611096672.142,"caller":"app/db.go:2","msg":"zap db warn"}
+{"time":"2021-01-19T22:51:12Z","level":"ERROR","source":{"file":"/app/main.go","line":3},"msg":"slog error"}
+{"time":"2021-01-19T22:51:12Z","level":"debug","file":"/app/main.go:4","msg":"logrus debug"}`,
+			" WARN: zap warn …\nERROR: slog error …\n",
+		},
+		{
+			"forced pino",
+			"pino", "simple", "", "",
+			`{"level":30,"time":"2021-01-19T22:51:12.142Z","msg":"iso time"}`,
+			" INFO: iso time\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetInputFormat(tc.inputFormat); err != nil {
+				t.Fatal(err)
+			}
+			r.SetLevelFilter(tc.level)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetInputFormatUnknown(t *testing.T) {
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.SetInputFormat("log4j")
+	want := "unknown input format 'log4j' (known input formats: auto, bunyan, ecs, logrus, pino, slog, zap)"
+	if err == nil || err.Error() != want {
+		t.Errorf("r.SetInputFormat(\"log4j\") error = %v, want %q", err, want)
+	}
+}
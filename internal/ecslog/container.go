@@ -0,0 +1,183 @@
+package ecslog
+
+// Support for unwrapping log lines from container runtime log files, e.g.
+// Docker's "json-file" logging driver and the Kubernetes CRI log format.
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// partialLine accumulates the chunks of a log line that a container runtime
+// split into multiple entries (e.g. Docker splits lines longer than 16k).
+type partialLine struct {
+	buf []byte
+	// long is true if the line is too long to be a log record, in which case
+	// its chunks are being passed through as they are read.
+	long bool
+	// json holds the lines of a multi-line JSON object (see
+	// SetMultilineJSON).
+	json jsonLines
+}
+
+// pending returns true iff a partial line is waiting for more chunks or
+// lines.
+func (p *partialLine) pending() bool {
+	return len(p.buf) > 0 || p.long || len(p.json.buf) > 0
+}
+
+// copyFrom sets p to a copy of the state of `src`.
+func (p *partialLine) copyFrom(src *partialLine) {
+	p.buf = append(p.buf[:0], src.buf...)
+	p.long = src.long
+	p.json.buf = append(p.json.buf[:0], src.json.buf...)
+	p.json.depth = src.json.depth
+	p.json.inString = src.json.inString
+	p.json.escaped = src.json.escaped
+}
+
+// dockerLogPrefix is how a Docker "json-file" logging driver entry starts.
+var dockerLogPrefix = []byte(`{"log":`)
+
+// dockerLogEntry returns the parts of a Docker "json-file" logging driver
+// entry, e.g.:
+//
+//     {"log":"hi\n","stream":"stdout","time":"2021-01-19T22:51:12.142Z"}
+//
+// An entry may also have an "attrs" object, with the labels, environment
+// variables, or tag selected by the "labels", "env", or "tag" log options.
+// The "stream" and the string values in "attrs" (as "attrs.NAME") are
+// returned as envelope fields.
+//
+// `final` is false if the entry is a chunk of a longer line, which Docker
+// marks by leaving off the trailing newline. It returns false if `rec` is not
+// such an entry.
+func dockerLogEntry(rec *fastjson.Value) (chunk []byte, env []envelopeField, final, ok bool) {
+	o := rec.GetObject()
+	if o == nil {
+		return nil, nil, false, false
+	}
+	attrsVal := o.Get("attrs")
+	switch {
+	case o.Len() == 3 && attrsVal == nil:
+	case o.Len() == 4 && attrsVal != nil && attrsVal.Type() == fastjson.TypeObject:
+	default:
+		return nil, nil, false, false
+	}
+	logVal := o.Get("log")
+	streamVal := o.Get("stream")
+	timeVal := o.Get("time")
+	if logVal == nil || logVal.Type() != fastjson.TypeString ||
+		streamVal == nil || streamVal.Type() != fastjson.TypeString ||
+		timeVal == nil || timeVal.Type() != fastjson.TypeString {
+		return nil, nil, false, false
+	}
+	chunk = logVal.GetStringBytes()
+	final = bytes.HasSuffix(chunk, []byte{'\n'})
+	if final {
+		chunk = bytes.TrimSuffix(chunk[:len(chunk)-1], []byte{'\r'})
+	}
+	env = []envelopeField{{key: "stream", value: string(streamVal.GetStringBytes())}}
+	if attrsVal != nil {
+		attrsVal.GetObject().Visit(func(k []byte, v *fastjson.Value) {
+			if v.Type() == fastjson.TypeString {
+				env = append(env, envelopeField{key: "attrs." + string(k), value: string(v.GetStringBytes())})
+			}
+		})
+	}
+	return chunk, env, final, true
+}
+
+// criLogEntry returns the parts of a Kubernetes CRI (Container Runtime
+// Interface) log line, as written to "/var/log/pods/...", e.g.:
+//
+//     2021-01-19T22:51:12.142532Z stdout F {"log.level":"info",...}
+//
+// The third field is "P" for a partial line, i.e. a chunk of a longer line,
+// or "F" for a full line (or the final chunk). It returns false if `line` is
+// not in this format.
+func criLogEntry(line []byte) (chunk []byte, stream string, final, ok bool) {
+	if len(line) == 0 || line[0] < '0' || line[0] > '9' {
+		return nil, "", false, false
+	}
+	// Check the stream before splitting the line, to cheaply rule out other
+	// lines that start with a date.
+	if sp := bytes.IndexByte(line, ' '); sp == -1 ||
+		!(bytes.HasPrefix(line[sp+1:], []byte("stdout")) || bytes.HasPrefix(line[sp+1:], []byte("stderr"))) {
+		return nil, "", false, false
+	}
+	parts := bytes.SplitN(line, []byte{' '}, 4)
+	if len(parts) < 3 {
+		return nil, "", false, false
+	}
+	stream = string(parts[1])
+	if stream != "stdout" && stream != "stderr" {
+		return nil, "", false, false
+	}
+	switch string(parts[2]) {
+	case "F":
+		final = true
+	case "P":
+		final = false
+	default:
+		return nil, "", false, false
+	}
+	if _, err := time.Parse(time.RFC3339Nano, string(parts[0])); err != nil {
+		return nil, "", false, false
+	}
+	if len(parts) == 4 {
+		chunk = parts[3]
+	}
+	return chunk, stream, final, true
+}
+
+// containerChunk returns whether `line` is a container runtime log entry
+// (`ok`), and if so whether it is the `final` chunk of a line. This is used
+// to find where a split line starts when seeking in the input.
+func (r *Renderer) containerChunk(line []byte) (final, ok bool) {
+	if bytes.HasPrefix(line, dockerLogPrefix) {
+		if rec, err := r.parser.ParseBytes(line); err == nil {
+			if _, _, final, ok := dockerLogEntry(rec); ok {
+				return final, true
+			}
+		}
+	}
+	_, _, final, ok = criLogEntry(line)
+	return final, ok
+}
+
+// processContainerChunk processes a chunk of a log line unwrapped from a
+// container runtime's log entry. Chunks are joined until the `final` one,
+// then the line is processed as if it were read directly. Fields from the
+// envelope are available for filtering the inner record.
+func (r *Renderer) processContainerChunk(chunk []byte, final bool, env ...envelopeField) renderItem {
+	p := r.partial
+	if p.long {
+		p.long = !final
+		return r.passthroughFragment(chunk, !final)
+	}
+	if !final {
+		if len(p.buf)+len(chunk) > r.maxLineLen {
+			// Too long to be a log record, so pass it through as it comes.
+			it := r.passthroughFragment(append(p.buf, chunk...), true)
+			p.buf = p.buf[:0]
+			p.long = true
+			return it
+		}
+		p.buf = append(p.buf, chunk...)
+		return renderItem{kind: itemNone, tsIdx: -1}
+	}
+
+	// Copy the chunk, because it may refer to memory that is re-used, e.g.
+	// by r.parser to parse the unwrapped line.
+	line := append(p.buf, chunk...)
+	p.buf = line[:0]
+	r.unwrapping = true
+	r.envFields = env
+	it := r.processLine(line)
+	r.unwrapping = false
+	r.envFields = nil
+	return it
+}
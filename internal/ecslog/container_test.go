@@ -0,0 +1,162 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestDockerJSONFile(t *testing.T) {
+	testCases := []struct {
+		name       string
+		kql        string
+		maxLineLen int
+		input      string
+		want       string
+	}{
+		{
+			"ecs record",
+			"", -1,
+			`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"hi\",\"foo\":\"bar\"}\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n    foo: \"bar\"\n",
+		},
+		{
+			"non-ecs line is unwrapped",
+			"", -1,
+			`{"log":"Server listening on port 3000\r\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}`,
+			"Server listening on port 3000\n",
+		},
+		{
+			"not an envelope",
+			"", -1,
+			`{"log":"hi\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z","foo":"bar"}`,
+			`{"log":"hi\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z","foo":"bar"}` + "\n",
+		},
+		{
+			"filter on stream",
+			"stream:stderr", -1,
+			`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"out\"}\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}
+{"log":"{\"log.level\":\"error\",\"@timestamp\":\"2021-01-19T22:51:13.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"err\"}\n","stream":"stderr","time":"2021-01-19T22:51:13.142532Z"}`,
+			"[2021-01-19T22:51:13.142Z] ERROR: err\n",
+		},
+		{
+			"attrs from log options",
+			"attrs.tag:api", -1,
+			`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"api\"}\n","stream":"stdout","attrs":{"tag":"api","com.example.team":"web"},"time":"2021-01-19T22:51:12.142532Z"}
+{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:13.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"db\"}\n","stream":"stdout","attrs":{"tag":"db"},"time":"2021-01-19T22:51:13.142532Z"}
+{"log":"hi\n","stream":"stdout","attrs":"tag","time":"2021-01-19T22:51:14.142532Z"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: api\n" +
+				`{"log":"hi\n","stream":"stdout","attrs":"tag","time":"2021-01-19T22:51:14.142532Z"}` + "\n",
+		},
+		{
+			"record stream field is not overridden",
+			"stream:foo", -1,
+			`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"hi\",\"stream\":\"foo\"}\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n    stream: \"foo\"\n",
+		},
+		{
+			"partial lines are joined",
+			"", -1,
+			`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}
+{"log":"\"ecs\":{\"version\":\"1.5.0\"},","stream":"stdout","time":"2021-01-19T22:51:12.142533Z"}
+{"log":"\"message\":\"hi\"}\n","stream":"stdout","time":"2021-01-19T22:51:12.142534Z"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"too long partial lines are passed through",
+			"", 20,
+			`{"log":"0123456789","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}
+{"log":"0123456789","stream":"stdout","time":"2021-01-19T22:51:12.142533Z"}
+{"log":"0123456789","stream":"stdout","time":"2021-01-19T22:51:12.142534Z"}
+{"log":"end\n","stream":"stdout","time":"2021-01-19T22:51:12.142535Z"}`,
+			strings.Repeat("0123456789", 3) + "end\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", "default", tc.maxLineLen, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCRILogFormat(t *testing.T) {
+	testCases := []struct {
+		name  string
+		kql   string
+		input string
+		want  string
+	}{
+		{
+			"ecs record",
+			"",
+			`2021-01-19T22:51:12.142532000Z stdout F {"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"hi","foo":"bar"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n    foo: \"bar\"\n",
+		},
+		{
+			"non-ecs line is unwrapped",
+			"",
+			"2021-01-19T22:51:12.142532000Z stderr F Server listening on port 3000\n" +
+				"2021-01-19T22:51:12.142532000Z stdout F ",
+			"Server listening on port 3000\n\n",
+		},
+		{
+			"not a CRI line",
+			"",
+			"2021-01-19T22:51:12.142532000Z stdin F hi\n" +
+				"2021-01-19 stdout F hi\n" +
+				"2021-01-19T22:51:12.142532000Z stdout X hi",
+			"2021-01-19T22:51:12.142532000Z stdin F hi\n" +
+				"2021-01-19 stdout F hi\n" +
+				"2021-01-19T22:51:12.142532000Z stdout X hi\n",
+		},
+		{
+			"filter on stream",
+			"stream:stderr",
+			`2021-01-19T22:51:12.142532000Z stdout F {"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"out"}
+2021-01-19T22:51:13.142532000Z stderr F {"log.level":"error","@timestamp":"2021-01-19T22:51:13.142Z","ecs":{"version":"1.5.0"},"message":"err"}`,
+			"[2021-01-19T22:51:13.142Z] ERROR: err\n",
+		},
+		{
+			"partial lines are joined",
+			"",
+			`2021-01-19T22:51:12.142532000Z stdout P {"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z",
+2021-01-19T22:51:12.142533000Z stdout P "ecs":{"version":"1.5.0"},
+2021-01-19T22:51:12.142534000Z stdout F "message":"hi"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
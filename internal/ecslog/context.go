@@ -0,0 +1,129 @@
+package ecslog
+
+// Support for grep-style context lines (`-A N`, `-B N`, `-C N`) around log
+// records that match the level and KQL filters.
+
+import (
+	"io"
+)
+
+// contextSeparator is written between non-adjacent groups of matching
+// records and their context, as with `grep`.
+const contextSeparator = "--"
+
+// contextState holds the state for writing context lines.
+type contextState struct {
+	before    []renderItem // held context lines, for `-B N`
+	numBefore int          // number of complete lines in `before`
+	afterLeft int          // number of context lines still to write, for `-A N`
+	skipped   bool         // true if context lines were dropped since the last write
+	written   bool         // true if any matching record has been written
+	trailing  trailingFate // what to do with trailing lines of the last record
+}
+
+// trailingFate is what happens to the trailing lines of a record when
+// grouping lines (see `SetGroupLines`): they go wherever the record went.
+type trailingFate int
+
+const (
+	trailingWrite trailingFate = iota // the record was written
+	trailingHold                      // the record is held in `before`
+	trailingDrop                      // the record was dropped
+)
+
+// SetContext sets the number of lines of context to render before and after
+// each log record matching the level and KQL filters (see `SetLevelFilter`
+// and `SetKQLFilter`). Records that do not match, and non-ecs-logging lines,
+// are context lines. They are rendered dimmed, and only if they are within
+// the given number of lines of a matching record.
+//
+// Context only applies if a level or KQL filter is set.
+func (r *Renderer) SetContext(before, after int) {
+	r.contextBefore = before
+	r.contextAfter = after
+}
+
+// hasContext returns true iff context lines are to be rendered.
+func (r *Renderer) hasContext() bool {
+	return (r.contextBefore > 0 || r.contextAfter > 0) &&
+		(r.levelFilter != "" || r.kqlFilter != nil)
+}
+
+// resetContext resets context state at the start of an input. Context lines
+// are not carried across inputs, and groups from separate inputs are
+// separated.
+func (r *Renderer) resetContext() {
+	c := &r.ctx
+	c.before = nil
+	c.numBefore = 0
+	c.afterLeft = 0
+	c.skipped = c.written
+	c.trailing = trailingDrop
+}
+
+// emitWithContext writes the output for the given item, holding on to
+// context lines until it is known whether they are within range of a
+// matching record.
+func (r *Renderer) emitWithContext(it *renderItem, out io.Writer) {
+	c := &r.ctx
+	switch {
+	case it.kind == itemRecord:
+		if c.skipped && c.written {
+			sep := renderItem{kind: itemPassthrough, text: contextSeparator, tsIdx: -1, context: true}
+			r.output(&sep, out)
+		}
+		for i := range c.before {
+			r.output(&c.before[i], out)
+		}
+		c.before = c.before[:0]
+		c.numBefore = 0
+		r.output(it, out)
+		c.afterLeft = r.contextAfter
+		c.skipped = false
+		c.written = true
+		c.trailing = trailingWrite
+
+	case it.trailing:
+		// Trailing lines are not counted as context lines.
+		switch c.trailing {
+		case trailingWrite:
+			r.output(it, out)
+		case trailingHold:
+			c.before = append(c.before, *it)
+		}
+
+	case it.context:
+		if c.afterLeft > 0 {
+			r.output(it, out)
+			if !it.partial {
+				c.afterLeft--
+			}
+			c.trailing = trailingWrite
+			return
+		}
+		c.before = append(c.before, *it)
+		if !it.partial {
+			c.numBefore++
+		}
+		c.trailing = trailingHold
+		for c.numBefore > r.contextBefore {
+			// Drop the oldest line, which may be in multiple fragments,
+			// along with any trailing lines that belong to it.
+			for len(c.before) > 0 {
+				dropped := c.before[0]
+				c.before = c.before[1:]
+				if !dropped.partial {
+					c.numBefore--
+					break
+				}
+			}
+			for len(c.before) > 0 && c.before[0].trailing {
+				c.before = c.before[1:]
+			}
+			if len(c.before) == 0 {
+				c.trailing = trailingDrop
+			}
+			c.skipped = true
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestContext(t *testing.T) {
+	log := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"one"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:13.142Z","ecs":{"version":"1.5.0"},"message":"two"}
+{"log.level":"error","@timestamp":"2021-01-19T22:51:14.142Z","ecs":{"version":"1.5.0"},"message":"three"}
+a stack trace line
+{"log.level":"info","@timestamp":"2021-01-19T22:51:15.142Z","ecs":{"version":"1.5.0"},"message":"four"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:16.142Z","ecs":{"version":"1.5.0"},"message":"five"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:17.142Z","ecs":{"version":"1.5.0"},"message":"six"}
+{"log.level":"error","@timestamp":"2021-01-19T22:51:18.142Z","ecs":{"version":"1.5.0"},"message":"seven"}
+{"log.level":"error","@timestamp":"2021-01-19T22:51:19.142Z","ecs":{"version":"1.5.0"},"message":"eight"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:20.142Z","ecs":{"version":"1.5.0"},"message":"nine"}
+`
+	testCases := []struct {
+		name           string
+		shouldColorize string
+		level          string
+		kql            string
+		before         int
+		after          int
+		want           string
+	}{
+		{
+			"after",
+			"no", "error", "", 0, 1,
+			"ERROR: three\na stack trace line\n--\nERROR: seven\nERROR: eight\n INFO: nine\n",
+		},
+		{
+			"before",
+			"no", "error", "", 2, 0,
+			" INFO: one\n INFO: two\nERROR: three\n--\n INFO: five\n INFO: six\nERROR: seven\nERROR: eight\n",
+		},
+		{
+			"adjacent groups are not separated",
+			"no", "", "log.level:error", 2, 2,
+			" INFO: one\n INFO: two\nERROR: three\na stack trace line\n INFO: four\n INFO: five\n INFO: six\nERROR: seven\nERROR: eight\n INFO: nine\n",
+		},
+		{
+			"no filter means no context",
+			"no", "", "", 1, 1,
+			" INFO: one\n INFO: two\nERROR: three\na stack trace line\n INFO: four\n INFO: five\n INFO: six\nERROR: seven\nERROR: eight\n INFO: nine\n",
+		},
+		{
+			"context is dimmed",
+			"yes", "error", "", 1, 1,
+			"\x1b[2m INFO: two\x1b[0m\n\x1b[31mERROR\x1b[0m: \x1b[36mthree\x1b[0m\n\x1b[2ma stack trace line\x1b[0m\n" +
+				"\x1b[2m--\x1b[0m\n" +
+				"\x1b[2m INFO: six\x1b[0m\n\x1b[31mERROR\x1b[0m: \x1b[36mseven\x1b[0m\n\x1b[31mERROR\x1b[0m: \x1b[36meight\x1b[0m\n\x1b[2m INFO: nine\x1b[0m\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer(tc.shouldColorize, "default", "simple", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetLevelFilter(tc.level)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			r.SetContext(tc.before, tc.after)
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(log), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -4,14 +4,17 @@ package ecslog
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/mattn/go-isatty"
 	"github.com/trentm/go-ecslog/internal/ansipainter"
+	"github.com/trentm/go-ecslog/internal/ingest"
 	"github.com/trentm/go-ecslog/internal/jsonutils"
 	"github.com/trentm/go-ecslog/internal/kqlog"
 	"github.com/trentm/go-ecslog/internal/lg"
@@ -27,6 +30,7 @@ const defaultMaxLineLen = 16384
 type Renderer struct {
 	parser            fastjson.Parser
 	painter           *ansipainter.ANSIPainter
+	plainPainter      *ansipainter.ANSIPainter // a no-color painter, e.g. for context lines
 	formatName        string
 	formatter         Formatter
 	maxLineLen        int
@@ -35,13 +39,46 @@ type Renderer struct {
 	ecsLenient        bool
 	timestampShowDiff bool
 	levelFilter       string
+	kql               string // the source of kqlFilter
 	kqlFilter         *kqlog.Filter
 	strict            bool
+	since             time.Time // if not zero, drop records before this time
+	until             time.Time // if not zero, drop records after this time
+	outOfTimeRange    bool      // true if the last record was dropped by the time range filter
+	headLimit         int       // if not zero, stop after this many rendered records
+	tailLimit         int       // if not zero, only render this many last records
+	contextBefore     int       // number of context lines before a matching record
+	contextAfter      int       // number of context lines after a matching record
+	linePrefixes      []linePrefix
+	workers           int            // number of goroutines for processing lines in RenderFile
+	inputAdapter      *recordAdapter // if not nil, all JSON records are in this format
+	autoAdapt         bool           // if true, detect the format of each JSON record
+	fieldMappings     []fieldMapping
+	pipeline          *ingest.Pipeline // if not nil, run on each record
+	renderJSON        bool             // if true, render non-ECS JSON records
+	multilineJSON     bool             // if true, recognize multi-line JSON objects
+	titleTemplate     *titleTemplate   // the title line template, see `SetTitleTemplate`
+	titleFields       []string         // fields to render on the title line
+	groupLines        bool             // if true, group trailing plain-text lines with records
+	humanizers        humanizers       // if not nil, humanize these number fields
 
 	line             []byte // the raw input line
 	logLevel         string // cached "log.level", read during isECSLoggingRecord
+	tsIdx            int    // index of the "[@timestamp]" in the formatted record, or -1
+	tsEnd            int    // end index of the "[@timestamp]" in the formatted record
 	lastTimestampBuf []byte // buffer to hold lastTimestamp values
 	lastTimestamp    []byte // last @timestamp (a slice of lastTimestampBuf)
+	numRendered      int    // number of records rendered from the current input
+	tailBuf          *tailBuffer
+	ctx              contextState
+	partial          *partialLine    // the current partial line, e.g. from a container runtime
+	unwrapping       bool            // true while processing a line unwrapped from an envelope
+	envFields        []envelopeField // envelope fields for the line being processed
+	envAdded         []string        // envelope fields added to the current record
+	arena            fastjson.Arena  // for creating values to add to records
+	adaptedLine      []byte          // the JSON of the current record, if converted
+	nonECS           bool            // true while formatting a non-ECS JSON record
+	group            groupState
 }
 
 // NewRenderer returns a new ECS logging log renderer.
@@ -93,13 +130,8 @@ func NewRenderer(shouldColorize, colorScheme, formatName string, maxLineLen int,
 
 	formatter, ok := formatterFromName[formatName]
 	if !ok {
-		var known []string
-		for n := range formatterFromName {
-			known = append(known, n)
-		}
-		sort.Strings(known)
 		return nil, fmt.Errorf("unknown format '%s' (known formats: %s)",
-			formatName, strings.Join(known, ", "))
+			formatName, strings.Join(FormatNames(), ", "))
 	}
 
 	if maxLineLen == -1 {
@@ -113,6 +145,7 @@ func NewRenderer(shouldColorize, colorScheme, formatName string, maxLineLen int,
 		formatName, shouldColorize, colorScheme, maxLineLen)
 	return &Renderer{
 		painter:           painter,
+		plainPainter:      ansipainter.New(nil),
 		formatName:        formatName,
 		formatter:         formatter,
 		maxLineLen:        maxLineLen,
@@ -120,10 +153,14 @@ func NewRenderer(shouldColorize, colorScheme, formatName string, maxLineLen int,
 		includeFields:     includeFields,
 		ecsLenient:        ecsLenient,
 		timestampShowDiff: timestampShowDiff,
+		titleTemplate:     defaultTitleTemplate,
 
 		// Can a timestamp ever reasonably be longer than 64 chars?
 		// "2021-04-15T04:22:29.507Z" is 24.
 		lastTimestampBuf: make([]byte, 64),
+		partial:          &partialLine{},
+		linePrefixes:     builtinLinePrefixes,
+		autoAdapt:        true,
 	}, nil
 }
 
@@ -138,11 +175,46 @@ func (r *Renderer) SetLevelFilter(level string) {
 func (r *Renderer) SetKQLFilter(kql string) error {
 	var err error
 	if kql != "" {
+		r.kql = kql
 		r.kqlFilter, err = kqlog.NewFilter(kql, LogLevelLess)
 	}
 	return err
 }
 
+// SetTimeRangeFilter sets the time range (inclusive) of records to render,
+// based on each record's "@timestamp". A zero `since` or `until` means the
+// range is unbounded on that side. Records without a parseable "@timestamp"
+// are dropped if either bound is set.
+//
+// Non-record lines have the time of the preceding record: they are dropped
+// if that record is dropped by the time range. Lines before the first record
+// are dropped if `since` is set.
+func (r *Renderer) SetTimeRangeFilter(since, until time.Time) {
+	r.since = since
+	r.until = until
+}
+
+// hasTimeRangeFilter returns true iff time range filtering is in effect.
+func (r *Renderer) hasTimeRangeFilter() bool {
+	return !r.since.IsZero() || !r.until.IsZero()
+}
+
+// inTimeRange returns true iff the given "@timestamp" value is within the
+// time range filter.
+func (r *Renderer) inTimeRange(timestamp string) bool {
+	t, ok := parseTimestamp(timestamp)
+	if !ok {
+		return false
+	}
+	if !r.since.IsZero() && t.Before(r.since) {
+		return false
+	}
+	if !r.until.IsZero() && t.After(r.until) {
+		return false
+	}
+	return true
+}
+
 // SetStrictFilter tells the renderer whether to strictly suppress input lines
 // that are not valid ecs-logging records.
 func (r *Renderer) SetStrictFilter(strict bool) {
@@ -269,23 +341,115 @@ func (r *Renderer) isECSLoggingRecord(rec *fastjson.Value) bool {
 	return true
 }
 
+// itemKind is the kind of a renderItem.
+type itemKind int
+
+const (
+	// itemNone is an input line that results in no output, e.g. a non-ECS line
+	// with `--strict`.
+	itemNone itemKind = iota
+	// itemPassthrough is an input line that is passed through unchanged.
+	itemPassthrough
+	// itemRecord is a rendered ecs-logging record.
+	itemRecord
+	// itemFiltered is an ecs-logging record that was filtered out, e.g. by
+	// `--level` or `--kql`. With context lines (see `SetContext`), such a
+	// record may still be written as context.
+	itemFiltered
+)
+
+// renderItem is the result of processing a single input line. Processing a
+// line (parsing, filtering, and formatting) is separate from writing its
+// output so that items can be re-ordered (e.g. when merging multiple files)
+// before being written.
+type renderItem struct {
+	kind itemKind
+	// text is the rendered output, without a trailing newline.
+	text string
+	// partial is true if `text` is a fragment of a very long line that is
+	// not yet terminated.
+	partial bool
+	// timestamp is the record's "@timestamp" value, if any.
+	timestamp string
+	// If tsIdx is not -1, `text[tsIdx:tsEnd]` is the unstyled
+	// "[@timestamp]" that is styled when the item is written.
+	tsIdx int
+	tsEnd int
+	// source is a label for the input source of this item, if any.
+	source string
+	// prefix is a prefix stripped from the input line (see
+	// `SetLinePrefixRegex`), written before the rendered record.
+	prefix string
+	// context is true if the item is to be written only as context around
+	// matching records (see `SetContext`). Its text is rendered dimmed.
+	context bool
+	// trailing is true if the item is a plain-text line that belongs to the
+	// preceding record (see `SetGroupLines`).
+	trailing bool
+	// flushed, if not nil, is the item for preceding input lines that were
+	// buffered as the start of a multi-line JSON object, but were not (see
+	// `SetMultilineJSON`). It is written before this item.
+	flushed *renderItem
+}
+
+// isRecord returns true iff the item is an ecs-logging record, whether it
+// was rendered or filtered out.
+func (it *renderItem) isRecord() bool {
+	return it.kind == itemRecord || it.kind == itemFiltered
+}
+
 // RenderFile renders log records from the given open file stream to the given
 // output stream (typically os.Stdout).
+//
+// If time range filtering is in effect and `in` is seekable (e.g. a regular
+// file), then the input is assumed to be in time order: a binary search is
+// used to find where to start reading, and reading stops after the end of the
+// time range.
+//
+// If a tail limit is set and `in` is seekable, then the input is read
+// backwards from the end to find where to start reading. Otherwise (or with
+// multi-line JSON, see SetMultilineJSON) the output for the last records is
+// held in memory until the end of the input.
+//
+// If more than one worker is set (see SetWorkers), lines are processed in
+// parallel and the output is written in input order.
 func (r *Renderer) RenderFile(in io.Reader, out io.Writer) error {
-	var b strings.Builder
-	eol := []byte{'\n'}
+	r.numRendered = 0
+	r.resetContext()
+	r.group = groupState{}
+	r.resetTimeRange()
+	seeker, seekable := in.(io.ReadSeeker)
+	if seekable {
+		// Seeking fails if, for example, the input is a pipe.
+		_, err := seeker.Seek(0, io.SeekCurrent)
+		seekable = err == nil
+	}
 
-	// For speed we want each processed line to fit in a single buffer that
-	// we don't need to copy/extend. That means at least:
-	//   maxLineLen + 2 (for '\r\n' line end)
-	// However if maxLineLen is configured to something really small, then
-	// that could hurt perf, so set a min of 64k (bufio.Scanner's default)
-	const minBufSize = 65536
-	bufSize := r.maxLineLen + 2
-	if bufSize < minBufSize {
-		bufSize = minBufSize
+	var stopAfterUntil bool
+	if r.tailLimit > 0 {
+		// seekToTail reads one line at a time, so cannot recognize records
+		// that span lines.
+		if seekable && !r.multilineJSON {
+			if err := r.seekToTail(seeker, r.tailLimit); err != nil {
+				return err
+			}
+		} else {
+			r.tailBuf = &tailBuffer{limit: r.tailLimit}
+			defer r.flushTail(out)
+		}
+	} else if seekable && r.hasTimeRangeFilter() {
+		sorted, err := r.seekToTimeRange(seeker)
+		if err != nil {
+			return err
+		}
+		stopAfterUntil = sorted && !r.until.IsZero()
+	}
+	// Seeking may have left a partial line from a container runtime.
+	r.partial = &partialLine{}
+	reader := bufio.NewReaderSize(in, r.readBufSize())
+	if r.workers > 1 {
+		return r.renderParallel(reader, out, stopAfterUntil)
 	}
-	reader := bufio.NewReaderSize(in, bufSize)
 
 	var wasPrefix bool
 	for {
@@ -301,6 +465,8 @@ func (r *Renderer) RenderFile(in io.Reader, out io.Writer) error {
 		// doesn't have one.
 		line, isPrefix, err := reader.ReadLine()
 		if err == io.EOF {
+			it := r.flushJSONLines()
+			r.emit(&it, out)
 			return nil
 		} else if err != nil {
 			return err
@@ -309,68 +475,307 @@ func (r *Renderer) RenderFile(in io.Reader, out io.Writer) error {
 			// This is a line > maxLineLen, so we just want to print it
 			// unchanged. The current line continues until `isPrefix == false`.
 			wasPrefix = isPrefix
-			if !r.strict {
-				out.Write(line)
-				if !isPrefix {
-					out.Write(eol)
-				}
-			}
+			it := r.passthroughFragment(line, isPrefix)
+			r.emit(&it, out)
 			continue
 		}
 
-		// For now, do *not* support lines with leading whitespace. Happy to
-		// reconsider if there is a real use case.
-		if len(line) == 0 || len(line) > r.maxLineLen || line[0] != '{' {
-			if !r.strict {
-				out.Write(line)
-				out.Write(eol)
-			}
-			continue
+		it := r.processLine(line)
+		if stopAfterUntil && it.kind == itemFiltered && r.pastTimeRange(it.timestamp) {
+			return nil
+		}
+		r.emit(&it, out)
+		if r.headDone() {
+			return nil
 		}
+	}
+}
 
-		rec, err := r.parser.ParseBytes(line)
-		if err != nil {
-			lg.Printf("line parse error: %s\n", err)
-			if !r.strict {
-				out.Write(line)
-				out.Write(eol)
-			}
-			continue
+// readBufSize returns the size of the buffer to use for reading input lines.
+func (r *Renderer) readBufSize() int {
+	// For speed we want each processed line to fit in a single buffer that
+	// we don't need to copy/extend. That means at least:
+	//   maxLineLen + 2 (for '\r\n' line end)
+	// However if maxLineLen is configured to something really small, then
+	// that could hurt perf, so set a min of 64k (bufio.Scanner's default)
+	const minBufSize = 65536
+	bufSize := r.maxLineLen + 2
+	if bufSize < minBufSize {
+		bufSize = minBufSize
+	}
+	return bufSize
+}
+
+// passthrough returns the item for an input line that is to be passed through
+// unchanged.
+func (r *Renderer) passthrough(line []byte) renderItem {
+	if r.strict {
+		if r.groupLines {
+			// The line may belong to a record (see groupItem).
+			return renderItem{kind: itemNone, text: string(line), tsIdx: -1}
 		}
+		return renderItem{kind: itemNone, tsIdx: -1}
+	}
+	return renderItem{kind: itemPassthrough, text: string(line), tsIdx: -1,
+		context: r.hasContext()}
+}
+
+// passthroughFragment returns the item for a fragment of a line that is too
+// long to be processed. `isPrefix` is true if the line continues.
+func (r *Renderer) passthroughFragment(frag []byte, isPrefix bool) renderItem {
+	it := r.passthrough(frag)
+	it.partial = isPrefix
+	return it
+}
+
+// processLine parses, filters, and formats a single complete input line
+// (without its line ending).
+func (r *Renderer) processLine(line []byte) renderItem {
+	if r.multilineJSON && !r.unwrapping {
+		if it, ok := r.processJSONLine(line); ok {
+			return it
+		}
+	}
+	if !r.unwrapping {
+		if chunk, stream, final, ok := criLogEntry(line); ok {
+			return r.processContainerChunk(chunk, final, envelopeField{key: "stream", value: stream})
+		}
+	}
 
-		if !r.isECSLoggingRecord(rec) {
-			if !r.strict {
-				out.Write(line)
-				out.Write(eol)
+	// For now, do *not* support lines with leading whitespace. Happy to
+	// reconsider if there is a real use case.
+	if len(line) == 0 || line[0] != '{' {
+		if !r.unwrapping {
+			if n, fields, ok := r.matchLinePrefix(line); ok {
+				return r.processPrefixedLine(line, n, fields)
+			}
+		}
+		if len(line) <= r.maxLineLen {
+			if r.pipeline != nil {
+				r.arena.Reset()
+				rec := r.arena.NewObject()
+				rec.Set("message", r.arena.NewStringBytes(line))
+				return r.processRecord(line, rec, false)
+			}
+			if rec := r.parseAccessLog(line); rec != nil {
+				return r.processRecord(line, rec, false)
+			}
+			if r.mayBeLogfmtRecord(line) {
+				if rec := r.parseLogfmt(line); rec != nil {
+					return r.processRecord(line, rec, false)
+				}
 			}
-			continue
 		}
-		r.line = line
+		return r.passthrough(line)
+	}
+	// A Docker log entry may be longer than maxLineLen because of its
+	// envelope. The limit then applies to the unwrapped line.
+	if len(line) > r.maxLineLen && (r.unwrapping || !bytes.HasPrefix(line, dockerLogPrefix)) {
+		return r.passthrough(line)
+	}
 
-		// `--level info` will drop any log records less than log.level=info.
-		if r.levelFilter != "" && LogLevelLess(r.logLevel, r.levelFilter) {
-			continue
+	rec, err := r.parser.ParseBytes(line)
+	if err != nil {
+		lg.Printf("line parse error: %s\n", err)
+		return r.passthrough(line)
+	}
+
+	if !r.unwrapping {
+		if chunk, env, final, ok := dockerLogEntry(rec); ok {
+			return r.processContainerChunk(chunk, final, env...)
+		}
+		if message, level, fields, ok := journalEntry(rec); ok {
+			return r.processJournalEntry(message, level, fields)
+		}
+	}
+
+	r.arena.Reset()
+	return r.processRecord(line, rec, true)
+}
+
+// processRecord filters and formats a record parsed from the given input
+// line. `isJSON` is false if the line is not the record's JSON, e.g. for a
+// logfmt line.
+func (r *Renderer) processRecord(line []byte, rec *fastjson.Value, isJSON bool) renderItem {
+	recLine := line
+	if r.pipeline != nil && !r.runPipeline(rec) {
+		return r.passthrough(line)
+	}
+	mapped := r.applyFieldMappings(rec)
+	if r.adaptRecord(rec) || mapped || !isJSON || r.pipeline != nil {
+		// The "ecs" format renders the converted record.
+		r.adaptedLine = rec.MarshalTo(r.adaptedLine[:0])
+		recLine = r.adaptedLine
+	}
+	r.addEnvelopeFields(rec)
+	var nonECS *nonECSTitle
+	if !r.isECSLoggingRecord(rec) {
+		if !r.renderJSON || !isJSON {
+			return r.passthrough(line)
 		}
+		nonECS = r.findNonECSTitle(rec)
+	}
+	r.line = recLine
+
+	it := renderItem{
+		kind:      itemFiltered,
+		timestamp: string(rec.GetStringBytes("@timestamp")),
+		tsIdx:     -1,
+	}
+	if nonECS != nil {
+		it.timestamp = nonECS.timestampValue(rec)
+	}
+
+	if r.hasTimeRangeFilter() && !r.inTimeRange(it.timestamp) {
+		return it
+	}
+
+	// `--level info` will drop any log records less than log.level=info.
+	// With context lines, a non-matching record is still rendered, as a
+	// possible context line.
+	matched := true
+	if r.levelFilter != "" && LogLevelLess(r.logLevel, r.levelFilter) {
+		matched = false
+	} else if r.kqlFilter != nil && !r.kqlFilter.Match(rec) {
+		matched = false
+	}
+	if !matched && !r.hasContext() {
+		return it
+	}
+	r.removeEnvelopeFields(rec)
+	if nonECS != nil {
+		nonECS.normalize(rec)
+	}
+	r.nonECS = nonECS != nil
 
-		if r.kqlFilter != nil && !r.kqlFilter.Match(rec) {
+	for _, xf := range r.excludeFields {
+		if len(xf) == 0 {
 			continue
+		} else if xf == "log.level" {
+			// Special case: log.level is already removed and cached on
+			// the Renderer.
+			r.logLevel = ""
+		} else {
+			jsonutils.ExtractValue(rec, strings.Split(xf, ".")...)
 		}
+	}
 
-		for _, xf := range r.excludeFields {
-			if len(xf) == 0 {
-				continue
-			} else if xf == "log.level" {
-				// Special case: log.level is already removed and cached on
-				// the Renderer.
-				r.logLevel = ""
-			} else {
-				jsonutils.ExtractValue(rec, strings.Split(xf, ".")...)
+	var b strings.Builder
+	r.tsIdx = -1
+	if !matched {
+		// Context lines are dimmed as a whole, rather than colorized.
+		painter := r.painter
+		r.painter = r.plainPainter
+		r.formatter.formatRecord(r, rec, &b)
+		r.painter = painter
+		it.text = b.String()
+		it.context = true
+		return it
+	}
+	r.formatter.formatRecord(r, rec, &b)
+	it.kind = itemRecord
+	it.text = b.String()
+	it.tsIdx = r.tsIdx
+	it.tsEnd = r.tsEnd
+	return it
+}
+
+// processPrefixedLine processes a line with a prefix of length `n` that was
+// recognized by matchLinePrefix. If the rest of the line is not a log record,
+// the whole line is passed through.
+func (r *Renderer) processPrefixedLine(line []byte, n int, fields []envelopeField) renderItem {
+	r.unwrapping = true
+	r.envFields = fields
+	it := r.processLine(line[n:])
+	r.unwrapping = false
+	r.envFields = nil
+	if it.kind == itemPassthrough {
+		return r.passthrough(line)
+	}
+	it.prefix = string(line[:n])
+	return it
+}
+
+// emit writes the output for the given item, if any.
+func (r *Renderer) emit(it *renderItem, out io.Writer) {
+	if it.flushed != nil {
+		flushed := it.flushed
+		it.flushed = nil
+		r.emit(flushed, out)
+	}
+	if r.hasTimeRangeFilter() {
+		r.timeRangeItem(it)
+	}
+	if r.groupLines {
+		r.groupItem(it)
+	}
+	if r.hasContext() {
+		r.emitWithContext(it, out)
+		return
+	}
+	r.output(it, out)
+}
+
+// output writes the output for the given item, if any. When only the last
+// records are wanted (`--tail N`), the item is held until the end of input.
+func (r *Renderer) output(it *renderItem, out io.Writer) {
+	if it.kind == itemNone || (it.kind == itemFiltered && !it.context) {
+		return
+	}
+	if r.tailBuf != nil {
+		r.tailBuf.add(it)
+		return
+	}
+	r.writeItem(it, out)
+	if it.kind == itemRecord {
+		r.numRendered++
+	}
+}
+
+// writeItem writes the rendered item to the output stream. This is where
+// the item's "@timestamp" is styled, because diff highlighting depends on the
+// preceding written record.
+func (r *Renderer) writeItem(it *renderItem, out io.Writer) {
+	var b strings.Builder
+	if it.source != "" {
+		r.painter.Paint(&b, "source")
+		b.WriteString(it.source)
+		r.painter.Reset(&b)
+		b.WriteString(" | ")
+	}
+	lineStart := b.Len()
+	if it.prefix != "" {
+		r.painter.Paint(&b, "source")
+		b.WriteString(it.prefix)
+		r.painter.Reset(&b)
+	}
+
+	if it.context {
+		// Dim each line separately, so that a line prefix (e.g. the source
+		// label) is not dimmed.
+		for i, line := range strings.Split(it.text, "\n") {
+			if i > 0 {
+				b.WriteByte('\n')
 			}
+			r.painter.Paint(&b, "context")
+			b.WriteString(line)
+			r.painter.Reset(&b)
 		}
+	} else if it.tsIdx == -1 {
+		b.WriteString(it.text)
+	} else {
+		b.WriteString(it.text[:it.tsIdx])
+		r.styleTimestamp([]byte(it.text[it.tsIdx+1:it.tsEnd-1]), &b)
+		b.WriteString(it.text[it.tsEnd:])
+	}
 
-		r.formatter.formatRecord(r, rec, &b)
-		out.Write([]byte(b.String()))
-		out.Write(eol)
-		b.Reset()
+	s := b.String()
+	if it.source != "" && strings.IndexByte(s[lineStart:], '\n') != -1 {
+		// Label each line of a multi-line rendered record.
+		s = strings.Replace(s, "\n", "\n"+s[:lineStart], -1)
+	}
+	io.WriteString(out, s)
+	if !it.partial {
+		out.Write([]byte{'\n'})
 	}
 }
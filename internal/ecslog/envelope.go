@@ -0,0 +1,57 @@
+package ecslog
+
+// Support for adding fields from an "envelope" around a log record, e.g. the
+// "stream" of a Docker log entry, or the host name of a journald entry.
+
+import (
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// envelopeField is a field from an envelope around a log line, added to the
+// inner record.
+type envelopeField struct {
+	key   string // a dotted field name, e.g. "host.hostname"
+	value string
+	// number is true if the value is a JSON number, rather than a string.
+	number bool
+	// override is true if the field replaces a value the record already has.
+	override bool
+	// render is true if the field is rendered with the record. Otherwise it
+	// is only available for filtering.
+	render bool
+}
+
+// addEnvelopeFields adds the fields from the envelope around the current line,
+// if any, to the record.
+func (r *Renderer) addEnvelopeFields(rec *fastjson.Value) {
+	r.envAdded = r.envAdded[:0]
+	if len(r.envFields) == 0 {
+		return
+	}
+	for _, f := range r.envFields {
+		lookup := strings.Split(f.key, ".")
+		if !f.override && jsonutils.LookupValue(rec, lookup...) != nil {
+			continue
+		}
+		v := r.arena.NewString(f.value)
+		if f.number {
+			v = r.arena.NewNumberString(f.value)
+		}
+		jsonutils.SetValue(rec, v, lookup...)
+		if !f.render {
+			r.envAdded = append(r.envAdded, f.key)
+		}
+	}
+}
+
+// removeEnvelopeFields removes fields added by addEnvelopeFields that are
+// not to be rendered.
+func (r *Renderer) removeEnvelopeFields(rec *fastjson.Value) {
+	for _, key := range r.envAdded {
+		jsonutils.ExtractValue(rec, strings.Split(key, ".")...)
+	}
+	r.envAdded = r.envAdded[:0]
+}
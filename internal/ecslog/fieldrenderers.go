@@ -0,0 +1,254 @@
+package ecslog
+
+// Support for rendering some fields of a log record specially, rather than as
+// JSON-ish extra fields, in the "default" and "compact" formats.
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// fieldRenderer renders some fields of a log record as blocks of text.
+type fieldRenderer interface {
+	// fields returns the top-level fields that the renderer may render.
+	fields() []string
+	// render returns the rendered blocks of text for the fields in `rec`, if
+	// any, and removes the rendered fields from `rec`. Lines in a block are
+	// separated by "\n". `message` is the record's "message", if any, which
+	// is rendered elsewhere, so need not be repeated.
+	render(rec *fastjson.Value, message []byte) []string
+}
+
+// fieldRenderers is the registry of field renderers, in the order in which
+// they are used.
+var fieldRenderers = []fieldRenderer{
+	&httpFieldRenderer{},
+}
+
+// renderFields returns the blocks of text from the field renderers for the
+// record. A field renderer is only used if all of its fields are included
+// (see the `includeFields` argument to `NewRenderer`).
+func (r *Renderer) renderFields(rec *fastjson.Value, message []byte) []string {
+	var blocks []string
+FieldRenderers:
+	for _, fr := range fieldRenderers {
+		for _, f := range fr.fields() {
+			if rest, ok := anyIsPrefix(r.includeFields, f); !ok || (len(rest) > 0 && rest[0] != "") {
+				continue FieldRenderers
+			}
+		}
+		blocks = append(blocks, fr.render(rec, message)...)
+	}
+	return blocks
+}
+
+// formatFieldBlocks writes the blocks of text from `renderFields`, after the
+// extra fields. Blocks are separated from each other and from any extra fields
+// by a "--" line.
+func formatFieldBlocks(b *strings.Builder, blocks []string, afterExtraFields bool) {
+	for i, block := range blocks {
+		if i > 0 || afterExtraFields {
+			b.WriteString("\n    --")
+		}
+		for _, line := range strings.Split(block, "\n") {
+			b.WriteByte('\n')
+			if line != "" {
+				b.WriteString("    ")
+				b.WriteString(line)
+			}
+		}
+	}
+}
+
+// httpFieldRenderer renders the ECS "http" and "url" fields as an HTTP/1.1
+// request and response, e.g.:
+//
+//    POST /api/users?dryRun=1 HTTP/1.1
+//    Host: example.com:8080
+//    Content-Length: 17
+//
+//    {"name": "trent"}
+//    --
+//    HTTP/1.1 201 Created
+//    Content-Type: application/json
+//
+// A request is rendered if there is an "http.request.method" and a
+// request target ("url.original", "url.path", or "url.full"). A response is
+// rendered if there is an "http.response.status_code". Fields that are not
+// part of the rendered request or response are left as extra fields.
+//
+// If the request line is the record's message, as for an access log line
+// (see `parseAccessLog`), then no request is rendered, and the other request
+// fields (e.g. "http.request.referrer") are left as extra fields.
+type httpFieldRenderer struct{}
+
+func (fr *httpFieldRenderer) fields() []string {
+	return []string{"http", "url"}
+}
+
+func (fr *httpFieldRenderer) render(rec *fastjson.Value, message []byte) []string {
+	method := lookupString(rec, "http", "request", "method")
+	var target []string // the lookup path of the request target
+	for _, lookup := range [][]string{{"url", "original"}, {"url", "path"}, {"url", "full"}} {
+		if lookupString(rec, lookup...) != nil {
+			target = lookup
+			break
+		}
+	}
+	hasRequest := method != nil && target != nil
+	statusCode := jsonutils.LookupValue(rec, "http", "response", "status_code")
+	hasResponse := statusCode != nil && statusCode.Type() == fastjson.TypeNumber
+	if !hasRequest && !hasResponse {
+		return nil
+	}
+
+	version := "1.1"
+	if v := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "http", "version"); v != nil {
+		version = string(v.GetStringBytes())
+	}
+
+	var blocks []string
+	var request strings.Builder
+	if hasRequest {
+		jsonutils.ExtractValue(rec, "http", "request", "method")
+		request.Write(method)
+		request.WriteByte(' ')
+		request.Write(jsonutils.ExtractValue(rec, target...).GetStringBytes())
+		if target[1] == "path" {
+			if query := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "url", "query"); query != nil {
+				request.WriteByte('?')
+				request.Write(query.GetStringBytes())
+			}
+		}
+		fmt.Fprintf(&request, " HTTP/%s", version)
+		if message != nil && request.String() == string(message) {
+			// Leave the other request fields as extra fields, rather than
+			// render a request without its request line.
+			hasRequest = false
+		}
+	}
+	if hasRequest {
+		headers := extractHTTPHeaders(rec, "http", "request", "headers")
+		if !headers.has("host") {
+			if domain := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "url", "domain"); domain != nil {
+				request.WriteString("\nHost: ")
+				request.Write(domain.GetStringBytes())
+				if port := jsonutils.ExtractValueOfType(rec, fastjson.TypeNumber, "url", "port"); port != nil {
+					request.WriteByte(':')
+					request.WriteString(port.String())
+				}
+			}
+		}
+		if !headers.has("referer") {
+			if referrer := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "http", "request", "referrer"); referrer != nil {
+				request.WriteString("\nReferer: ")
+				request.Write(referrer.GetStringBytes())
+			}
+		}
+		formatHTTPMessageRest(&request, rec, "request", headers)
+		blocks = append(blocks, request.String())
+	}
+	if hasResponse {
+		var b strings.Builder
+		jsonutils.ExtractValue(rec, "http", "response", "status_code")
+		fmt.Fprintf(&b, "HTTP/%s %s", version, statusCode.String())
+		if text := http.StatusText(statusCode.GetInt()); text != "" {
+			b.WriteByte(' ')
+			b.WriteString(text)
+		}
+		headers := extractHTTPHeaders(rec, "http", "response", "headers")
+		formatHTTPMessageRest(&b, rec, "response", headers)
+		blocks = append(blocks, b.String())
+	}
+	return blocks
+}
+
+// formatHTTPMessageRest writes the headers and body of the HTTP request or
+// response (`kind`), after the request line or status line.
+func formatHTTPMessageRest(b *strings.Builder, rec *fastjson.Value, kind string, headers httpHeaders) {
+	if !headers.has("content-type") {
+		if mimeType := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "http", kind, "mime_type"); mimeType != nil {
+			b.WriteString("\nContent-Type: ")
+			b.Write(mimeType.GetStringBytes())
+		}
+	}
+	if !headers.has("content-length") {
+		if n := jsonutils.ExtractValueOfType(rec, fastjson.TypeNumber, "http", kind, "body", "bytes"); n != nil {
+			b.WriteString("\nContent-Length: ")
+			b.WriteString(n.String())
+		}
+	}
+	for _, h := range headers {
+		b.WriteByte('\n')
+		b.WriteString(h.name)
+		b.WriteString(": ")
+		b.WriteString(h.value)
+	}
+	if content := jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "http", kind, "body", "content"); content != nil {
+		b.WriteString("\n\n")
+		b.Write(content.GetStringBytes())
+	}
+}
+
+type httpHeader struct {
+	name  string
+	value string
+}
+
+// httpHeaders is a list of HTTP headers, in order.
+type httpHeaders []httpHeader
+
+// has returns true iff there is a header with the given lower case name.
+func (hs httpHeaders) has(name string) bool {
+	for _, h := range hs {
+		if strings.ToLower(h.name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// extractHTTPHeaders extracts the HTTP headers object at the given lookup
+// path, e.g. `{"accept": "*/*", "set-cookie": ["a=1", "b=2"]}`. The headers
+// are left in the record if they are not an object of strings or arrays of
+// strings.
+func extractHTTPHeaders(rec *fastjson.Value, lookup ...string) httpHeaders {
+	obj := jsonutils.LookupValue(rec, lookup...).GetObject()
+	if obj == nil {
+		return nil
+	}
+	var headers httpHeaders
+	valid := true
+	obj.Visit(func(k []byte, v *fastjson.Value) {
+		values := []*fastjson.Value{v}
+		if v.Type() == fastjson.TypeArray {
+			values = v.GetArray()
+		}
+		for _, hv := range values {
+			if hv.Type() != fastjson.TypeString {
+				valid = false
+				return
+			}
+			headers = append(headers, httpHeader{string(k), string(hv.GetStringBytes())})
+		}
+	})
+	if !valid {
+		return nil
+	}
+	jsonutils.ExtractValue(rec, lookup...)
+	return headers
+}
+
+// lookupString returns the string value at the given lookup path in the
+// record, or nil.
+func lookupString(rec *fastjson.Value, lookup ...string) []byte {
+	v := jsonutils.LookupValue(rec, lookup...)
+	if v == nil || v.Type() != fastjson.TypeString {
+		return nil
+	}
+	return v.GetStringBytes()
+}
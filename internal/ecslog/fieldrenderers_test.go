@@ -0,0 +1,97 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestHTTPFieldRenderer(t *testing.T) {
+	prefix := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi",`
+	testCases := []struct {
+		name          string
+		formatName    string
+		includeFields []string
+		input         string
+		want          string
+	}{
+		{
+			"request and response",
+			"default", []string{},
+			prefix + `"http":{"version":"1.1","request":{"method":"POST","mime_type":"application/json","body":{"bytes":17,"content":"{\"name\": \"trent\"}"},"headers":{"accept":"*/*","x-forwarded-for":["10.0.0.1","10.0.0.2"]}},` +
+				`"response":{"status_code":201,"headers":{"Content-Type":"application/json"}}},` +
+				`"url":{"path":"/api/users","query":"dryRun=1","domain":"example.com","port":8080,"scheme":"http"}}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi
+    url: {
+        "scheme": "http"
+    }
+    --
+    POST /api/users?dryRun=1 HTTP/1.1
+    Host: example.com:8080
+    Content-Type: application/json
+    Content-Length: 17
+    accept: */*
+    x-forwarded-for: 10.0.0.1
+    x-forwarded-for: 10.0.0.2
+
+    {"name": "trent"}
+    --
+    HTTP/1.1 201 Created
+    Content-Type: application/json
+`,
+		},
+		{
+			"response only",
+			"compact", []string{},
+			prefix + `"http":{"request":{"id":"abc"},"response":{"status_code":599,"bytes":42}}}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi
+    http: {"request": {"id": "abc"}, "response": {"bytes": 42}}
+    --
+    HTTP/1.1 599
+`,
+		},
+		{
+			"request without a target is not rendered",
+			"compact", []string{},
+			prefix + `"http":{"request":{"method":"GET"}}}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi
+    http: {"request": {"method": "GET"}}
+`,
+		},
+		{
+			"invalid headers are extra fields",
+			"compact", []string{},
+			prefix + `"http":{"request":{"method":"GET","headers":{"a":1}}},"url":{"original":"/"}}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi
+    http: {"request": {"headers": {"a": 1}}}
+    --
+    GET / HTTP/1.1
+`,
+		},
+		{
+			"not rendered if not all fields are included",
+			"compact", []string{"http"},
+			prefix + `"http":{"request":{"method":"GET"}},"url":{"original":"/"}}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi
+    http: {"request": {"method": "GET"}}
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, tc.includeFields, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input+"\n"), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package ecslog
+
+// Support for following log files (like `tail -F`): rendering lines as they
+// are appended, and re-opening files that are rotated or truncated.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/trentm/go-ecslog/internal/lg"
+)
+
+// FollowPollInterval is how often a followed file is checked for new data,
+// rotation, or truncation after it has been read to EOF.
+var FollowPollInterval = 250 * time.Millisecond
+
+// followChunk is a piece of input from a followed file. It is either a
+// complete line (without its line ending) or, for lines longer than the read
+// buffer, a fragment of a line (`isPrefix` is true for all but the last
+// fragment).
+type followChunk struct {
+	idx      int // index of the followed file
+	data     []byte
+	isPrefix bool
+}
+
+// followState is the rendering state for each followed file, so that lines
+// from one file are not grouped with (see `SetGroupLines`), or counted as
+// context of (see `SetContext`), records from another.
+type followState struct {
+	label          string // the source label for items, if following several files
+	wasPrefix      bool
+	partial        partialLine
+	ctx            contextState
+	group          groupState
+	outOfTimeRange bool
+}
+
+// follower reads new lines from a single file, handling rotation (the path
+// now refers to a different file) and truncation (the file got shorter).
+type follower struct {
+	idx     int
+	path    string
+	bufSize int
+	f       *os.File
+	fi      os.FileInfo
+	reader  *bufio.Reader
+	offset  int64  // number of bytes read from the current file
+	pending []byte // a partial line read before hitting EOF
+}
+
+func newFollower(idx int, path string, bufSize int) (*follower, error) {
+	fw := &follower{idx: idx, path: path, bufSize: bufSize}
+	if err := fw.open(); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+func (fw *follower) open() error {
+	f, err := os.Open(fw.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fw.f = f
+	fw.fi = fi
+	fw.offset = 0
+	fw.pending = nil
+	if fw.reader == nil {
+		fw.reader = bufio.NewReaderSize(f, fw.bufSize)
+	} else {
+		fw.reader.Reset(f)
+	}
+	return nil
+}
+
+func (fw *follower) close() {
+	if fw.f != nil {
+		fw.f.Close()
+		fw.f = nil
+	}
+}
+
+// readAvailable sends all complete lines currently available in the file to
+// `chunks`. It returns at EOF, holding on to any partial last line until the
+// rest of it is written.
+func (fw *follower) readAvailable(chunks chan<- followChunk, stop <-chan struct{}) error {
+	for {
+		data, err := fw.reader.ReadSlice('\n')
+		fw.offset += int64(len(data))
+		switch err {
+		case nil:
+			line := trimEOL(data)
+			if len(fw.pending) > 0 {
+				line = append(fw.pending, line...)
+				fw.pending = nil
+			} else {
+				line = append([]byte(nil), line...)
+			}
+			if !fw.send(chunks, stop, followChunk{fw.idx, line, false}) {
+				return nil
+			}
+		case bufio.ErrBufferFull:
+			// A line longer than our buffer is passed through in fragments.
+			frag := append(fw.pending, data...)
+			fw.pending = nil
+			if !fw.send(chunks, stop, followChunk{fw.idx, frag, true}) {
+				return nil
+			}
+		case io.EOF:
+			if len(data) > 0 {
+				fw.pending = append(fw.pending, data...)
+				if len(fw.pending) >= fw.bufSize {
+					frag := fw.pending
+					fw.pending = nil
+					if !fw.send(chunks, stop, followChunk{fw.idx, frag, true}) {
+						return nil
+					}
+				}
+			}
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// send sends a chunk, returning false if following was stopped.
+func (fw *follower) send(chunks chan<- followChunk, stop <-chan struct{}, c followChunk) bool {
+	select {
+	case chunks <- c:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// checkRotation looks at the file currently at `fw.path` and re-opens it if
+// the file was rotated or truncated.
+func (fw *follower) checkRotation(chunks chan<- followChunk, stop <-chan struct{}) {
+	fi, err := os.Stat(fw.path)
+	if err != nil {
+		// The file may be mid-rotation. Try again on the next poll.
+		lg.Printf("follow: stat '%s': %s\n", fw.path, err)
+		return
+	}
+
+	if fw.f == nil || !os.SameFile(fw.fi, fi) {
+		lg.Printf("follow: '%s' was rotated, re-opening\n", fw.path)
+		if fw.f != nil {
+			// Get anything written to the old file before it was rotated.
+			if err := fw.readAvailable(chunks, stop); err != nil {
+				lg.Printf("follow: read '%s': %s\n", fw.path, err)
+			}
+			fw.flushPending(chunks, stop)
+			fw.close()
+		}
+		if err := fw.open(); err != nil {
+			lg.Printf("follow: open '%s': %s\n", fw.path, err)
+		}
+		return
+	}
+
+	if fi.Size() < fw.offset {
+		lg.Printf("follow: '%s' was truncated, reading from the start\n", fw.path)
+		if _, err := fw.f.Seek(0, io.SeekStart); err != nil {
+			lg.Printf("follow: seek '%s': %s\n", fw.path, err)
+			return
+		}
+		fw.reader.Reset(fw.f)
+		fw.offset = 0
+		fw.pending = nil
+	}
+	fw.fi = fi
+}
+
+// flushPending sends a held partial last line as a complete line. This is
+// used when we know no more data will be appended to the current file.
+func (fw *follower) flushPending(chunks chan<- followChunk, stop <-chan struct{}) {
+	if len(fw.pending) > 0 {
+		fw.send(chunks, stop, followChunk{fw.idx, fw.pending, false})
+		fw.pending = nil
+	}
+}
+
+func (fw *follower) run(chunks chan<- followChunk, stop <-chan struct{}) {
+	defer fw.close()
+	for {
+		if fw.f != nil {
+			if err := fw.readAvailable(chunks, stop); err != nil {
+				lg.Printf("follow: read '%s': %s\n", fw.path, err)
+			}
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(FollowPollInterval):
+		}
+		fw.checkRotation(chunks, stop)
+	}
+}
+
+func trimEOL(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+		if n := len(line); n > 0 && line[n-1] == '\r' {
+			line = line[:n-1]
+		}
+	}
+	return line
+}
+
+// FollowFiles renders log records from the given log files, then continues
+// to render lines as they are appended to those files, in the order they
+// are read. A file that is rotated (the path is renamed or replaced) is
+// re-opened, and a file that is truncated is read again from the start.
+//
+// If a tail limit is set, following starts with the last records of each
+// file. If a head limit is set, this returns after that many records have
+// been rendered. If following more than one file, each output line is
+// prefixed with its file name, as for RenderMerged.
+//
+// This returns when `stop` is closed. If any of the files cannot be opened
+// initially, an error is returned before following begins.
+func (r *Renderer) FollowFiles(paths []string, out io.Writer, stop <-chan struct{}) error {
+	bufSize := r.readBufSize()
+
+	var followers []*follower
+	for i, path := range paths {
+		fw, err := newFollower(i, path, bufSize)
+		if err == nil && r.tailLimit > 0 && !r.multilineJSON {
+			// Like `tail -F -n N`, start with the last records in each file.
+			if err = r.seekToTail(fw.f, r.tailLimit); err == nil {
+				fw.offset, err = fw.f.Seek(0, io.SeekCurrent)
+				fw.reader.Reset(fw.f)
+			}
+			if err != nil {
+				fw.close()
+			}
+		}
+		if err != nil {
+			for _, fw := range followers {
+				fw.close()
+			}
+			return err
+		}
+		followers = append(followers, fw)
+	}
+
+	// `quit` stops the followers when this returns, whether because `stop`
+	// was closed or the head limit was reached.
+	chunks := make(chan followChunk, 64)
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(quit)
+	r.numRendered = 0
+	r.resetContext()
+	r.group = groupState{}
+	r.resetTimeRange()
+	// Rendering is done on this goroutine so that Renderer state (e.g. the
+	// last timestamp for diff highlighting) is carried across all files.
+	labelWidth := 0
+	for _, path := range paths {
+		if len(path) > labelWidth {
+			labelWidth = len(path)
+		}
+	}
+	states := make([]followState, len(paths))
+	for i := range states {
+		if len(paths) > 1 {
+			states[i].label = fmt.Sprintf("%-*s", labelWidth, paths[i])
+		}
+		states[i].ctx = r.ctx
+		states[i].group = r.group
+		states[i].outOfTimeRange = r.outOfTimeRange
+	}
+	renderChunk := func(c followChunk) {
+		s := &states[c.idx]
+		r.partial = &s.partial
+		r.ctx, r.group, r.outOfTimeRange = s.ctx, s.group, s.outOfTimeRange
+		var it renderItem
+		if s.wasPrefix || c.isPrefix {
+			it = r.passthroughFragment(c.data, c.isPrefix)
+			if !s.wasPrefix {
+				// Only label the start of a long line.
+				it.source = s.label
+			}
+			s.wasPrefix = c.isPrefix
+		} else {
+			it = r.processLine(c.data)
+			it.source = s.label
+			if it.flushed != nil {
+				it.flushed.source = s.label
+			}
+		}
+		r.emit(&it, out)
+		s.ctx, s.group, s.outOfTimeRange = r.ctx, r.group, r.outOfTimeRange
+	}
+
+	if r.tailLimit > 0 && r.multilineJSON {
+		// seekToTail cannot recognize records that span lines, so render the
+		// current content of each file, holding the output for the last
+		// records.
+		for _, fw := range followers {
+			r.tailBuf = &tailBuffer{limit: r.tailLimit}
+			initial := make(chan followChunk)
+			var err error
+			go func() {
+				err = fw.readAvailable(initial, quit)
+				close(initial)
+			}()
+			for c := range initial {
+				renderChunk(c)
+			}
+			if err != nil {
+				lg.Printf("follow: read '%s': %s\n", fw.path, err)
+			}
+			r.flushTail(out)
+		}
+		if r.headDone() {
+			return nil
+		}
+	}
+
+	for _, fw := range followers {
+		wg.Add(1)
+		go func(fw *follower) {
+			defer wg.Done()
+			fw.run(chunks, quit)
+		}(fw)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case c := <-chunks:
+			renderChunk(c)
+			if r.headDone() {
+				return nil
+			}
+		}
+	}
+}
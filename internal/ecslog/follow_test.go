@@ -0,0 +1,252 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForOutput waits for `out` to have the `want` content.
+func waitForOutput(t *testing.T, out *syncBuffer, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if out.String() == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Fatalf("r.FollowFiles() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func appendToFile(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowFiles(t *testing.T) {
+	ecslog.FollowPollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "ecslog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "app.log")
+	appendToFile(t, logPath, `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"one"}`+"\n")
+
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out syncBuffer
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- r.FollowFiles([]string{logPath}, &out, stop)
+	}()
+
+	want := "[2021-01-19T22:51:12.142Z]  INFO: one\n"
+	waitForOutput(t, &out, want)
+
+	// Appended lines are rendered, even if written in pieces.
+	appendToFile(t, logPath, `{"log.level":"info","@timestamp":"2021-01-19T22:51:13.142Z",`)
+	time.Sleep(50 * time.Millisecond)
+	appendToFile(t, logPath, `"ecs":{"version":"1.5.0"},"message":"two"}`+"\nnot json\n")
+	want += "[2021-01-19T22:51:13.142Z]  INFO: two\nnot json\n"
+	waitForOutput(t, &out, want)
+
+	// Rotation: the file is renamed and a new one created at the same path.
+	if err = os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, logPath+".1", "last line in rotated file\n")
+	appendToFile(t, logPath, `{"log.level":"warn","@timestamp":"2021-01-19T22:51:14.142Z","ecs":{"version":"1.5.0"},"message":"three"}`+"\n")
+	want += "last line in rotated file\n[2021-01-19T22:51:14.142Z]  WARN: three\n"
+	waitForOutput(t, &out, want)
+
+	// Truncation: the file is read again from the start.
+	if err = os.Truncate(logPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendToFile(t, logPath, "four\n")
+	want += "four\n"
+	waitForOutput(t, &out, want)
+
+	close(stop)
+	if err = <-done; err != nil {
+		t.Errorf("r.FollowFiles() error: %s", err)
+	}
+}
+
+func TestFollowFilesSeveral(t *testing.T) {
+	ecslog.FollowPollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "ecslog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	aPath := filepath.Join(dir, "a.log")
+	bPath := filepath.Join(dir, "bb.log")
+	appendToFile(t, aPath, "")
+	appendToFile(t, bPath, "")
+
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetGroupLines(true)
+	var out syncBuffer
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- r.FollowFiles([]string{aPath, bPath}, &out, stop)
+	}()
+
+	// Each line is labelled with its file, and a plain line is only grouped
+	// with a record from the same file.
+	appendToFile(t, aPath, `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"one"}`+"\n")
+	want := aPath + "  |  INFO: one\n"
+	waitForOutput(t, &out, want)
+	appendToFile(t, bPath, "not grouped\n")
+	want += bPath + " | not grouped\n"
+	waitForOutput(t, &out, want)
+	appendToFile(t, aPath, "grouped\n")
+	want += aPath + "  |     grouped\n"
+	waitForOutput(t, &out, want)
+
+	close(stop)
+	if err = <-done; err != nil {
+		t.Errorf("r.FollowFiles() error: %s", err)
+	}
+}
+
+func TestFollowFilesMissingFile(t *testing.T) {
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out syncBuffer
+	err = r.FollowFiles([]string{"/this/file/does/not/exist.log"}, &out, nil)
+	if err == nil {
+		t.Errorf("r.FollowFiles() on a missing file did not error")
+	}
+}
+
+func TestFollowFilesHeadTail(t *testing.T) {
+	ecslog.FollowPollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "ecslog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "app.log")
+	for _, msg := range []string{"one", "two", "three"} {
+		appendToFile(t, logPath, `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"`+msg+`"}`+"\n")
+	}
+
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTailLimit(1)
+	r.SetHeadLimit(2)
+	var out syncBuffer
+	done := make(chan error)
+	go func() {
+		done <- r.FollowFiles([]string{logPath}, &out, nil)
+	}()
+
+	// Following starts with the last record, and stops after two records.
+	waitForOutput(t, &out, " INFO: three\n")
+	appendToFile(t, logPath, `{"log.level":"info","@timestamp":"2021-01-19T22:51:13.142Z","ecs":{"version":"1.5.0"},"message":"four"}`+"\n")
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("r.FollowFiles() error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("r.FollowFiles() did not return after the head limit")
+	}
+	if diff := cmp.Diff(" INFO: three\n INFO: four\n", out.String()); diff != "" {
+		t.Errorf("r.FollowFiles() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFollowFilesTailMultilineJSON(t *testing.T) {
+	ecslog.FollowPollInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "ecslog-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "app.log")
+	for _, msg := range []string{"one", "two", "three"} {
+		appendToFile(t, logPath, "{\n  \"log.level\": \"info\",\n  \"@timestamp\": \"2021-01-19T22:51:12.142Z\",\n  \"ecs.version\": \"1.6.0\",\n  \"message\": \""+msg+"\"\n}\n")
+	}
+
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetMultilineJSON(true)
+	r.SetTailLimit(1)
+	r.SetHeadLimit(2)
+	var out syncBuffer
+	done := make(chan error)
+	go func() {
+		done <- r.FollowFiles([]string{logPath}, &out, nil)
+	}()
+
+	waitForOutput(t, &out, " INFO: three\n")
+	appendToFile(t, logPath, "{\n  \"log.level\": \"info\",\n  \"@timestamp\": \"2021-01-19T22:51:13.142Z\",\n  \"ecs.version\": \"1.6.0\",\n  \"message\": \"four\"\n}\n")
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("r.FollowFiles() error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("r.FollowFiles() did not return after the head limit")
+	}
+	if diff := cmp.Diff(" INFO: three\n INFO: four\n", out.String()); diff != "" {
+		t.Errorf("r.FollowFiles() mismatch (-want +got):\n%s", diff)
+	}
+}
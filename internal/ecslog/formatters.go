@@ -3,6 +3,7 @@ package ecslog
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/trentm/go-ecslog/internal/ansipainter"
@@ -20,52 +21,61 @@ type defaultFormatter struct{}
 
 func (f *defaultFormatter) formatRecord(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 	jsonutils.ExtractValue(rec, "ecs", "version")
-	jsonutils.ExtractValue(rec, "log", "level")
-	formatDefaultTitleLine(r, rec, b)
+	message := lookupString(rec, "message")
+	formatTitleLine(r, rec, b)
+	formatTitleFields(r, rec, b)
+	blocks := r.renderFields(rec, message)
 
 	// Render the remaining fields:
 	//    $key: <render $value as indented JSON-ish>
 	// where "JSON-ish" is:
 	// - 4-space indentation
 	// - special casing multiline string values (commonly "error.stack_trace")
-	// - possible configurable key-specific rendering -- e.g. render "http"
+	// - key-specific rendering by field renderers -- e.g. render "http"
 	//   fields as a HTTP request/response text representation
 	obj := rec.GetObject()
+	numExtraFields := 0
 	obj.Visit(func(k []byte, v *fastjson.Value) {
 		includeFields, ok := anyIsPrefix(r.includeFields, string(k))
 		if !ok {
 			return
 		}
+		numExtraFields++
 		b.WriteString("\n    ")
 		r.painter.Paint(b, "extraField")
 		b.Write(k)
 		r.painter.Reset(b)
 		b.WriteString(": ")
-		formatJSONValue(b, v, "    ", "    ", r.painter, false, includeFields)
+		formatJSONValue(b, v, "    ", "    ", r.painter, false, includeFields, string(k), r.humanizers)
 	})
+	formatFieldBlocks(b, blocks, numExtraFields > 0)
 }
 
 type compactFormatter struct{}
 
 func (f *compactFormatter) formatRecord(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 	jsonutils.ExtractValue(rec, "ecs", "version")
-	jsonutils.ExtractValue(rec, "log", "level")
 
-	formatDefaultTitleLine(r, rec, b)
+	message := lookupString(rec, "message")
+	formatTitleLine(r, rec, b)
+	formatTitleFields(r, rec, b)
+	blocks := r.renderFields(rec, message)
 
 	// Render the remaining fields:
 	//    $key: <render $value as compact JSON-ish>
 	// where "compact JSON-ish" means:
 	// - on one line if it roughtly fits in 80 columns, else 4-space indented
 	// - special casing multiline string values (commonly "error.stack_trace")
-	// - possible configurable key-specific rendering -- e.g. render "http"
+	// - key-specific rendering by field renderers -- e.g. render "http"
 	//   fields as a HTTP request/response text representation
 	obj := rec.GetObject()
+	numExtraFields := 0
 	obj.Visit(func(k []byte, v *fastjson.Value) {
 		includeFields, ok := anyIsPrefix(r.includeFields, string(k))
 		if !ok {
 			return
 		}
+		numExtraFields++
 		b.WriteString("\n    ")
 		r.painter.Paint(b, "extraField")
 		b.Write(k)
@@ -80,11 +90,12 @@ func (f *compactFormatter) formatRecord(r *Renderer, rec *fastjson.Value, b *str
 		vStr := v.String()
 		// 80 (quotable width) - 8 (indentation) - length of `k` - len(": ")
 		if len(vStr) < 80-8-len(k)-2 {
-			formatJSONValue(b, v, "    ", "    ", r.painter, true, includeFields)
+			formatJSONValue(b, v, "    ", "    ", r.painter, true, includeFields, string(k), r.humanizers)
 		} else {
-			formatJSONValue(b, v, "    ", "    ", r.painter, false, includeFields)
+			formatJSONValue(b, v, "    ", "    ", r.painter, false, includeFields, string(k), r.humanizers)
 		}
 	})
+	formatFieldBlocks(b, blocks, numExtraFields > 0)
 }
 
 // commonPrefixIdx returns the largest index into a and b for which the bytes
@@ -145,15 +156,13 @@ func commonRFC3339TzIdx(a, b []byte) int {
 	return -1
 }
 
-// formatTimestamp will write a styled `@timestamp` field to `b`.
-// For example:
-//    `[2021-04-15T04:22:29.507Z] `
+// styleTimestamp will write a styled `[@timestamp]` to `b`.
 //
 // If the `timestampShowDiff` config is true (the default), then given:
 //    lastTimestamp = '2021-05-20T22:50:44+00:00'
 //    @timestamp = '2021-05-20T22:51:23+00:00'
 // we expect:
-//    `[2021-05-20T22:51:23+00:00] `
+//    `[2021-05-20T22:51:23+00:00]`
 //     ^                         ^-- styled with role "timestamp"
 //      ^^^^^^^^^^^^^^^    ^^^^^^--- styled with role "timestampSame"
 //                     ^^^^--------- styled with role "timestampDiff"
@@ -161,8 +170,7 @@ func commonRFC3339TzIdx(a, b []byte) int {
 // The `[` and `]` delimiters are styled with role "timestamp", unless the
 // whole timestamp is the same or different -- in which case the "timestampSame"
 // or "timestampDiff" role is used, respectively.
-func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
-	timestamp := jsonutils.ExtractValue(rec, "@timestamp").GetStringBytes()
+func (r *Renderer) styleTimestamp(timestamp []byte, b *strings.Builder) {
 	if r.timestampShowDiff {
 		// If we are styling timestamp diffs, finish by making a copy
 		// of this timestamp for rendering the next record.
@@ -172,10 +180,6 @@ func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 		}()
 	}
 
-	if timestamp == nil {
-		return
-	}
-
 	if !r.timestampShowDiff || r.lastTimestamp == nil {
 		// Not showing timestamp diffs, or this is the first timestamp.
 		r.painter.Paint(b, "timestamp")
@@ -183,7 +187,6 @@ func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 		b.Write(timestamp)
 		b.WriteByte(']')
 		r.painter.Reset(b)
-		b.WriteByte(' ')
 		return
 	}
 
@@ -195,7 +198,6 @@ func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 		b.Write(timestamp)
 		b.WriteByte(']')
 		r.painter.Reset(b)
-		b.WriteByte(' ')
 		return
 	}
 
@@ -207,7 +209,6 @@ func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 		b.Write(timestamp)
 		b.WriteByte(']')
 		r.painter.Reset(b)
-		b.WriteByte(' ')
 		return
 	}
 
@@ -234,75 +235,12 @@ func formatTimestamp(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
 	r.painter.Paint(b, "timestamp")
 	b.WriteByte(']')
 	r.painter.Reset(b)
-	b.WriteByte(' ')
-}
-
-func formatDefaultTitleLine(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
-	var val *fastjson.Value
-	var logLogger []byte
-	if val = jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "log", "logger"); val != nil {
-		logLogger = val.GetStringBytes()
-	}
-	var serviceName []byte
-	if val = jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "service", "name"); val != nil {
-		serviceName = val.GetStringBytes()
-	}
-	var hostHostname []byte
-	if val = jsonutils.ExtractValueOfType(rec, fastjson.TypeString, "host", "hostname"); val != nil {
-		hostHostname = val.GetStringBytes()
-	}
-
-	message := jsonutils.ExtractValue(rec, "message").GetStringBytes()
-
-	// Title line pattern:
-	//
-	//    [@timestamp] LOG.LEVEL (log.logger/service.name on host.hostname): message
-	//
-	// Note: See https://github.com/trentm/go-ecslog/issues/24 for likely
-	// re-work of the default title line.
-	formatTimestamp(r, rec, b)
-	if r.logLevel != "" {
-		r.painter.Paint(b, strings.ToLower(r.logLevel))
-		fmt.Fprintf(b, "%5s", strings.ToUpper(r.logLevel))
-		r.painter.Reset(b)
-	}
-	if logLogger != nil || serviceName != nil || hostHostname != nil {
-		b.WriteString(" (")
-		alreadyWroteSome := false
-		if logLogger != nil {
-			b.Write(logLogger)
-			alreadyWroteSome = true
-		}
-		if serviceName != nil {
-			if alreadyWroteSome {
-				b.WriteByte('/')
-			}
-			b.Write(serviceName)
-			alreadyWroteSome = true
-		}
-		if hostHostname != nil {
-			if alreadyWroteSome {
-				b.WriteByte(' ')
-			}
-			b.WriteString("on ")
-			b.Write(hostHostname)
-		}
-		b.WriteByte(')')
-	}
-	if b.Len() > 0 {
-		b.WriteByte(':')
-	}
-	if message != nil {
-		if b.Len() > 0 {
-			b.WriteByte(' ')
-		}
-		r.painter.Paint(b, "message")
-		b.Write(message)
-		r.painter.Reset(b)
-	}
 }
 
-func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent string, painter *ansipainter.ANSIPainter, compact bool, includeFields []string) {
+// formatJSONValue writes the value `v` of the dotted `field` as JSON-ish.
+// Number fields with a humanizer in `hz` are followed by their humanized
+// value, e.g. `10226197680 (10.23s)`.
+func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent string, painter *ansipainter.ANSIPainter, compact bool, includeFields []string, field string, hz humanizers) {
 	var i uint
 
 	switch v.Type() {
@@ -332,7 +270,11 @@ func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent s
 			b.WriteByte('"')
 			painter.Reset(b)
 			b.WriteString(": ")
-			formatJSONValue(b, subv, currIndent+indent, indent, painter, compact, nestedIncludeFields)
+			subField := ""
+			if hz != nil {
+				subField = field + "." + string(subk)
+			}
+			formatJSONValue(b, subv, currIndent+indent, indent, painter, compact, nestedIncludeFields, subField, hz)
 			i++
 		})
 		if !compact && i != 0 {
@@ -354,7 +296,7 @@ func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent s
 				b.WriteString(currIndent)
 				b.WriteString(indent)
 			}
-			formatJSONValue(b, subv, currIndent+indent, indent, painter, compact, includeFields)
+			formatJSONValue(b, subv, currIndent+indent, indent, painter, compact, includeFields, field, hz)
 		}
 		if !compact && len(v.GetArray()) != 0 {
 			b.WriteByte('\n')
@@ -378,6 +320,14 @@ func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent s
 		painter.Paint(b, "jsonNumber")
 		b.WriteString(v.String())
 		painter.Reset(b)
+		if h := hz.lookup(field); h != nil {
+			if s := h(v); s != "" {
+				b.WriteString(" ")
+				painter.Paint(b, "humanized")
+				b.WriteString("(" + s + ")")
+				painter.Reset(b)
+			}
+		}
 	case fastjson.TypeTrue:
 		painter.Paint(b, "jsonTrue")
 		b.WriteString(v.String())
@@ -395,6 +345,20 @@ func formatJSONValue(b *strings.Builder, v *fastjson.Value, currIndent, indent s
 	}
 }
 
+// formatNonECSMarker writes a "[non-ECS]" marker for a non-ECS JSON record
+// rendered with `--render-json`.
+func formatNonECSMarker(r *Renderer, b *strings.Builder) {
+	if !r.nonECS {
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	r.painter.Paint(b, "nonECS")
+	b.WriteString("[non-ECS]")
+	r.painter.Reset(b)
+}
+
 // ecsFormatter formats log records as the raw original ECS JSON line.
 type ecsFormatter struct{}
 
@@ -419,6 +383,7 @@ func (f *simpleFormatter) formatRecord(r *Renderer, rec *fastjson.Value, b *stri
 		fmt.Fprintf(b, "%5s", strings.ToUpper(r.logLevel))
 		r.painter.Reset(b)
 	}
+	formatNonECSMarker(r, b)
 	if b.Len() > 0 {
 		b.WriteByte(':')
 	}
@@ -450,6 +415,16 @@ var formatterFromName = map[string]Formatter{
 	"compact": &compactFormatter{},
 }
 
+// FormatNames returns the names of the built-in output formats, sorted.
+func FormatNames() []string {
+	var names []string
+	for n := range formatterFromName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // returns whether any of the include items is a prefix of key, along with the postfix (if any)
 func anyIsPrefix(includes []string, key string) ([]string, bool) {
 	if len(includes) == 0 || (len(includes) == 1 && includes[0] == "") {
@@ -0,0 +1,68 @@
+package ecslog
+
+// Support for grouping plain-text lines that follow a log record (e.g. a
+// stack trace written after a JSON record) with that record.
+
+import (
+	"strings"
+)
+
+// groupIndent is the indentation for rendered trailing lines, as for extra
+// fields.
+const groupIndent = "    "
+
+// groupState holds the state for grouping trailing lines with the preceding
+// record.
+type groupState struct {
+	open    bool     // true if following plain-text lines belong to the last record
+	kind    itemKind // the kind of the last record
+	context bool     // true if the last record is a context line
+	midLine bool     // true if the last trailing item was a partial line
+}
+
+// SetGroupLines tells the renderer whether to group non-JSON lines that follow
+// a log record, up to the next record, with that record. Such lines are
+// filtered together with the record and are rendered indented beneath it.
+func (r *Renderer) SetGroupLines(groupLines bool) {
+	r.groupLines = groupLines
+}
+
+// groupItem marks the given item as trailing the preceding record, if it is a
+// plain-text line that follows a record. A trailing item is written iff its
+// record is written.
+func (r *Renderer) groupItem(it *renderItem) {
+	g := &r.group
+	if it.isRecord() {
+		if r.headReached() {
+			// This record is beyond the head limit, so its trailing lines are
+			// not wanted either.
+			*g = groupState{}
+			it.kind = itemNone
+			return
+		}
+		*g = groupState{open: true, kind: it.kind, context: it.context}
+		return
+	}
+	if !g.open || (it.kind == itemNone && it.text == "") {
+		return
+	}
+	if (it.kind != itemPassthrough && it.kind != itemNone) ||
+		(!g.midLine && strings.HasPrefix(it.text, "{")) {
+		// A JSON line that is not a record ends the group.
+		g.open = false
+		return
+	}
+
+	it.trailing = true
+	if g.kind == itemRecord {
+		it.kind = itemPassthrough
+		it.context = false
+	} else {
+		it.kind = itemFiltered
+		it.context = g.context
+	}
+	if !g.midLine && r.formatName != "ecs" && it.text != "" {
+		it.text = groupIndent + it.text
+	}
+	g.midLine = it.partial
+}
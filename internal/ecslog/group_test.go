@@ -0,0 +1,112 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestGroupLines(t *testing.T) {
+	info := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"started"}` + "\n"
+	errRec := `{"log.level":"error","@timestamp":"2021-01-19T22:51:12.143Z","ecs.version":"1.6.0","message":"boom"}` + "\n"
+	trace := "Traceback (most recent call last):\n  File \"app.py\", line 1\n"
+	testCases := []struct {
+		name       string
+		level      string
+		before     int
+		after      int
+		strict     bool
+		headLimit  int
+		formatName string
+		input      string
+		want       string
+	}{
+		{
+			"trailing lines are indented",
+			"", 0, 0, false, 0, "default",
+			"before\n" + errRec + trace + "\n" + info,
+			"before\n" +
+				"[2021-01-19T22:51:12.143Z] ERROR: boom\n" +
+				"    Traceback (most recent call last):\n" +
+				"      File \"app.py\", line 1\n" +
+				"\n" +
+				"[2021-01-19T22:51:12.142Z]  INFO: started\n",
+		},
+		{
+			"trailing lines are filtered with the record",
+			"warn", 0, 0, false, 0, "default",
+			info + trace + errRec + trace,
+			"[2021-01-19T22:51:12.143Z] ERROR: boom\n" +
+				"    Traceback (most recent call last):\n" +
+				"      File \"app.py\", line 1\n",
+		},
+		{
+			"a non-record JSON line ends the group",
+			"warn", 0, 0, false, 0, "default",
+			info + "{\"foo\":1}\nafter\n",
+			"{\"foo\":1}\nafter\n",
+		},
+		{
+			"trailing lines are kept in strict mode",
+			"", 0, 0, true, 0, "default",
+			"before\n" + errRec + trace,
+			"[2021-01-19T22:51:12.143Z] ERROR: boom\n" +
+				"    Traceback (most recent call last):\n" +
+				"      File \"app.py\", line 1\n",
+		},
+		{
+			"trailing lines are not counted as context",
+			"error", 1, 0, false, 0, "default",
+			info + info + trace + errRec,
+			"[2021-01-19T22:51:12.142Z]  INFO: started\n" +
+				"    Traceback (most recent call last):\n" +
+				"      File \"app.py\", line 1\n" +
+				"[2021-01-19T22:51:12.143Z] ERROR: boom\n",
+		},
+		{
+			"trailing lines of a dropped context record are dropped",
+			"error", 0, 1, false, 0, "default",
+			errRec + info + info + trace + errRec,
+			"[2021-01-19T22:51:12.143Z] ERROR: boom\n" +
+				"[2021-01-19T22:51:12.142Z]  INFO: started\n" +
+				"--\n" +
+				"[2021-01-19T22:51:12.143Z] ERROR: boom\n",
+		},
+		{
+			"head limit includes trailing lines",
+			"", 0, 0, false, 1, "default",
+			errRec + trace + errRec + trace,
+			"[2021-01-19T22:51:12.143Z] ERROR: boom\n" +
+				"    Traceback (most recent call last):\n" +
+				"      File \"app.py\", line 1\n",
+		},
+		{
+			"ecs format is not indented",
+			"", 0, 0, false, 0, "ecs",
+			errRec + trace,
+			errRec + trace,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetGroupLines(true)
+			r.SetLevelFilter(tc.level)
+			r.SetContext(tc.before, tc.after)
+			r.SetStrictFilter(tc.strict)
+			r.SetHeadLimit(tc.headLimit)
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
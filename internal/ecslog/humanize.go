@@ -0,0 +1,219 @@
+package ecslog
+
+// Support for humanized rendering of some number fields (`--humanize`), e.g.
+// "event.duration" (in nanoseconds) as "10.23s".
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// defaultHumanizeFields is the built-in table of fields to humanize, mapping
+// a field name, or a "*.NAME" pattern, to a kind (see `SetHumanize`).
+var defaultHumanizeFields = map[string]string{
+	"event.duration": "duration",
+	"*.uptime":       "duration:s", // "host.uptime" and "process.uptime"
+	"*.bytes":        "bytes",
+	"file.size":      "bytes",
+	"*.timestamp":    "epoch",
+	"event.created":  "epoch",
+	"event.start":    "epoch",
+	"event.end":      "epoch",
+	"event.ingested": "epoch",
+}
+
+// humanizer returns a human-readable string for a number value, or "" if
+// there isn't one.
+type humanizer func(v *fastjson.Value) string
+
+// humanizers maps a field name, or a "*.NAME" pattern, to a humanizer.
+type humanizers map[string]humanizer
+
+// lookup returns the humanizer for the given dotted field name, or nil.
+// An exact field name is preferred to a pattern, and a longer pattern (e.g.
+// "*.body.bytes") to a shorter one (e.g. "*.bytes").
+func (hz humanizers) lookup(field string) humanizer {
+	if hz == nil {
+		return nil
+	}
+	if h, ok := hz[field]; ok {
+		return h
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] == '.' {
+			if h, ok := hz["*"+field[i:]]; ok {
+				return h
+			}
+		}
+	}
+	return nil
+}
+
+// durationUnits are the units, in nanoseconds, allowed with the "duration"
+// and "epoch" kinds, e.g. "duration:ms".
+var durationUnits = map[string]float64{"ns": 1, "us": 1e3, "ms": 1e6, "s": 1e9}
+
+// SetHumanize sets whether to humanize number fields in the extra fields of
+// the "default" and "compact" formats. The raw value is kept, e.g.
+// `"duration": 10226197680 (10.23s)`, so rendering remains lossless.
+//
+// `fields` extends (or overrides) the built-in table of fields to humanize.
+// It maps a field name, or a "*.NAME" pattern matching any field ending in
+// ".NAME", to one of these kinds:
+//
+// - "duration": a duration in nanoseconds, e.g. "10.23s". A unit may be given,
+//   e.g. "duration:ms". Known units are "ns", "us", "ms", and "s".
+// - "bytes": a number of bytes, e.g. "1.4 MiB".
+// - "epoch": a time since the Unix epoch, e.g. "2021-01-19T22:51:12.142Z". A
+//   unit may be given, e.g. "epoch:ms". Without one, the unit is guessed from
+//   the size of the number.
+// - "none": do not humanize the field, e.g. to turn off a built-in entry.
+func (r *Renderer) SetHumanize(humanize bool, fields map[string]string) error {
+	r.humanizers = nil
+	if !humanize {
+		return nil
+	}
+	hz := make(humanizers)
+	for _, table := range []map[string]string{defaultHumanizeFields, fields} {
+		for field, kind := range table {
+			h, err := humanizerFromKind(kind)
+			if err != nil {
+				return fmt.Errorf("invalid humanize field '%s': %s", field, err)
+			}
+			if h == nil {
+				delete(hz, field)
+			} else {
+				hz[field] = h
+			}
+		}
+	}
+	r.humanizers = hz
+	return nil
+}
+
+// humanizerFromKind returns the humanizer for a kind, e.g. "duration:ms", or
+// nil for the "none" kind.
+func humanizerFromKind(kind string) (humanizer, error) {
+	name, unit := kind, ""
+	if idx := strings.IndexByte(kind, ':'); idx != -1 {
+		name, unit = kind[:idx], kind[idx+1:]
+	}
+	switch name {
+	case "duration", "bytes", "epoch", "none":
+	default:
+		return nil, fmt.Errorf("unknown kind '%s' (known kinds: bytes, duration, epoch, none)", name)
+	}
+	var unitNs float64
+	if unit != "" {
+		if name != "duration" && name != "epoch" {
+			return nil, fmt.Errorf("kind '%s' does not take a unit", name)
+		}
+		var ok bool
+		if unitNs, ok = durationUnits[unit]; !ok {
+			return nil, fmt.Errorf("unknown unit '%s' (known units: ns, us, ms, s)", unit)
+		}
+	}
+
+	switch name {
+	case "duration":
+		if unitNs == 0 {
+			unitNs = 1
+		}
+		return func(v *fastjson.Value) string {
+			return humanizeDuration(v.GetFloat64() * unitNs)
+		}, nil
+	case "bytes":
+		return func(v *fastjson.Value) string {
+			return humanizeBytes(v.GetFloat64())
+		}, nil
+	case "epoch":
+		return func(v *fastjson.Value) string {
+			return humanizeEpoch(v, unitNs)
+		}, nil
+	}
+	return nil, nil // "none"
+}
+
+// humanizeDuration returns a duration in nanoseconds in the largest unit
+// less than it, e.g. "10.23s", or as hours, minutes, and seconds if a minute
+// or longer, e.g. "1h2m3s".
+func humanizeDuration(ns float64) string {
+	sign := ""
+	if ns < 0 {
+		sign = "-"
+		ns = -ns
+	}
+	switch {
+	case ns < 1e3:
+		return sign + formatDecimal(ns) + "ns"
+	case ns < 1e6:
+		return sign + formatDecimal(ns/1e3) + "µs"
+	case ns < 1e9:
+		return sign + formatDecimal(ns/1e6) + "ms"
+	case ns < 60e9:
+		return sign + formatDecimal(ns/1e9) + "s"
+	case ns < math.MaxInt64:
+		return sign + time.Duration(ns).Round(time.Second).String()
+	default:
+		return sign + formatDecimal(ns/float64(time.Hour)) + "h"
+	}
+}
+
+// humanizeBytes returns a number of bytes in binary (IEC) units, e.g.
+// "1.4 MiB".
+func humanizeBytes(n float64) string {
+	if math.Abs(n) < 1024 {
+		return strconv.FormatFloat(n, 'f', -1, 64) + " B"
+	}
+	const units = "KMGTPE"
+	i := 0
+	for n /= 1024; math.Abs(n) >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1f %ciB", n, units[i])
+}
+
+// humanizeEpoch returns a time since the Unix epoch in the given unit (in
+// nanoseconds) as an RFC 3339 UTC time. If `unitNs` is zero, the unit is
+// guessed from the size of the number: seconds, milliseconds, microseconds,
+// or nanoseconds for times roughly between 1973 and 5138.
+func humanizeEpoch(v *fastjson.Value, unitNs float64) string {
+	f := v.GetFloat64()
+	if unitNs == 0 {
+		switch abs := math.Abs(f); {
+		case abs < 1e11:
+			unitNs = 1e9
+		case abs < 1e14:
+			unitNs = 1e6
+		case abs < 1e17:
+			unitNs = 1e3
+		default:
+			unitNs = 1
+		}
+	}
+	var t time.Time
+	unit := int64(unitNs)
+	if n, err := v.Int64(); err == nil && n <= math.MaxInt64/unit && n >= math.MinInt64/unit {
+		t = time.Unix(0, n*unit) // avoid float rounding for integer times
+	} else {
+		ns := f * unitNs
+		if math.Abs(ns) >= math.MaxInt64 {
+			return ""
+		}
+		t = time.Unix(0, int64(ns))
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// formatDecimal returns `f` with at most 2 decimal places, and without
+// trailing zeros.
+func formatDecimal(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
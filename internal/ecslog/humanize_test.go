@@ -0,0 +1,112 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestHumanize(t *testing.T) {
+	testCases := []struct {
+		name       string
+		formatName string
+		humanize   bool
+		fields     map[string]string
+		input      string
+		want       string
+	}{
+		{
+			"off",
+			"compact",
+			false,
+			nil,
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","event":{"duration":10226197680}}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n" +
+				"    event: {\"duration\": 10226197680}\n",
+		},
+		{
+			"built-in fields",
+			"default",
+			true,
+			nil,
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","event":{"duration":10226197680,"created":1611096672142,"code":"a"},"source.bytes":1468006,"destination":{"bytes":[512,3221225472]},"host":{"uptime":3723},"file.size":"big"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n" +
+				"    event: {\n" +
+				"        \"duration\": 10226197680 (10.23s),\n" +
+				"        \"created\": 1611096672142 (2021-01-19T22:51:12.142Z),\n" +
+				"        \"code\": \"a\"\n" +
+				"    }\n" +
+				"    source.bytes: 1468006 (1.4 MiB)\n" +
+				"    destination: {\n" +
+				"        \"bytes\": [\n" +
+				"            512 (512 B),\n" +
+				"            3221225472 (3.0 GiB)\n" +
+				"        ]\n" +
+				"    }\n" +
+				"    host: {\n" +
+				"        \"uptime\": 3723 (1h2m3s)\n" +
+				"    }\n" +
+				"    file.size: \"big\"\n",
+		},
+		{
+			"extra fields",
+			"compact",
+			true,
+			map[string]string{"myapp.elapsed": "duration:ms", "*.size": "bytes", "event.duration": "none"},
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","myapp":{"elapsed":1.5,"cache.size":2048},"event":{"duration":250,"end":1611096672}}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n" +
+				"    myapp: {\"elapsed\": 1.5 (1.5ms), \"cache.size\": 2048 (2.0 KiB)}\n" +
+				"    event: {\"duration\": 250, \"end\": 1611096672 (2021-01-19T22:51:12Z)}\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetHumanize(tc.humanize, tc.fields); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input+"\n"), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHumanizeErrors(t *testing.T) {
+	testCases := []struct {
+		fields  map[string]string
+		wantErr string
+	}{
+		{
+			map[string]string{"a": "size"},
+			"invalid humanize field 'a': unknown kind 'size' (known kinds: bytes, duration, epoch, none)",
+		},
+		{
+			map[string]string{"a": "duration:min"},
+			"invalid humanize field 'a': unknown unit 'min' (known units: ns, us, ms, s)",
+		},
+		{
+			map[string]string{"a": "bytes:kb"},
+			"invalid humanize field 'a': kind 'bytes' does not take a unit",
+		},
+	}
+	for _, tc := range testCases {
+		r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.SetHumanize(true, tc.fields)
+		if err == nil || err.Error() != tc.wantErr {
+			t.Errorf("r.SetHumanize(%v) error = %v, want %q", tc.fields, err, tc.wantErr)
+		}
+	}
+}
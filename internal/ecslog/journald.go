@@ -0,0 +1,126 @@
+package ecslog
+
+// Support for rendering systemd journal entries, as output by
+// `journalctl -o json`.
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/trentm/go-ecslog/internal/lg"
+	"github.com/valyala/fastjson"
+)
+
+// journalLevelFromPriority maps a journal entry's syslog "PRIORITY" (0 is
+// "emerg", 7 is "debug") to a log level name.
+var journalLevelFromPriority = []string{
+	"fatal", // emerg
+	"fatal", // alert
+	"fatal", // crit
+	"error", // err
+	"warn",  // warning
+	"info",  // notice
+	"info",  // info
+	"debug", // debug
+}
+
+// journalString returns the string value of the given field of a journal
+// entry. The journal exports field values that are not valid UTF-8 as an
+// array of byte values.
+func journalString(rec *fastjson.Value, key string) ([]byte, bool) {
+	v := rec.Get(key)
+	if v == nil {
+		return nil, false
+	}
+	switch v.Type() {
+	case fastjson.TypeString:
+		return v.GetStringBytes(), true
+	case fastjson.TypeArray:
+		arr := v.GetArray()
+		s := make([]byte, 0, len(arr))
+		for _, b := range arr {
+			n, err := b.Int()
+			if err != nil || n < 0 || n > 255 {
+				return nil, false
+			}
+			s = append(s, byte(n))
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// journalEntry returns the parts of a journal entry from
+// `journalctl -o json`: the "MESSAGE", the log level from "PRIORITY", and the
+// journal fields to map onto the record. It returns false if `rec` is not a
+// journal entry.
+func journalEntry(rec *fastjson.Value) (message []byte, level string, fields []envelopeField, ok bool) {
+	realtime, ok := journalString(rec, "__REALTIME_TIMESTAMP")
+	if !ok {
+		return nil, "", nil, false
+	}
+	message, ok = journalString(rec, "MESSAGE")
+	if !ok {
+		return nil, "", nil, false
+	}
+	// Copy the message, because it refers to memory in r.parser, which is
+	// re-used to parse the message.
+	message = append([]byte(nil), message...)
+
+	level = "info"
+	if priority, ok := journalString(rec, "PRIORITY"); ok {
+		if p, err := strconv.Atoi(string(priority)); err == nil && p >= 0 && p < len(journalLevelFromPriority) {
+			level = journalLevelFromPriority[p]
+		}
+	}
+
+	if hostname, ok := journalString(rec, "_HOSTNAME"); ok {
+		fields = append(fields, envelopeField{key: "host.hostname", value: string(hostname),
+			override: true, render: true})
+	}
+	if pid, ok := journalString(rec, "_PID"); ok {
+		if _, err := strconv.Atoi(string(pid)); err == nil {
+			fields = append(fields, envelopeField{key: "process.pid", value: string(pid),
+				number: true, override: true, render: true})
+		}
+	}
+	if unit, ok := journalString(rec, "_SYSTEMD_UNIT"); ok {
+		fields = append(fields, envelopeField{key: "service.name", value: string(unit),
+			render: true})
+	}
+	// "__REALTIME_TIMESTAMP" is in microseconds since the epoch.
+	if usec, err := strconv.ParseInt(string(realtime), 10, 64); err == nil {
+		t := time.Unix(0, usec*int64(time.Microsecond)).UTC()
+		fields = append(fields, envelopeField{key: "@timestamp",
+			value: t.Format("2006-01-02T15:04:05.000000Z07:00"), render: true})
+	}
+	return message, level, fields, true
+}
+
+// processJournalEntry processes the message of a journal entry, with journal
+// fields mapped onto the record. A message that is not an ecs-logging record
+// is rendered as a record synthesized from the message and the journal
+// fields.
+func (r *Renderer) processJournalEntry(message []byte, level string, fields []envelopeField) renderItem {
+	r.unwrapping = true
+	r.envFields = fields
+	defer func() {
+		r.unwrapping = false
+		r.envFields = nil
+	}()
+
+	if len(message) > 0 && message[0] == '{' {
+		it := r.processLine(message)
+		if it.kind != itemPassthrough && it.kind != itemNone {
+			return it
+		}
+	}
+
+	lg.Printf("synthesize record from plain-text journal message\n")
+	r.arena.Reset()
+	rec := r.arena.NewObject()
+	rec.Set("log.level", r.arena.NewString(level))
+	rec.Set("message", r.arena.NewStringBytes(message))
+	rec.Set("ecs.version", r.arena.NewString(adaptedECSVersion))
+	return r.processLine(rec.MarshalTo(nil))
+}
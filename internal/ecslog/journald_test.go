@@ -0,0 +1,70 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestJournalEntries(t *testing.T) {
+	testCases := []struct {
+		name   string
+		kql    string
+		strict bool
+		input  string
+		want   string
+	}{
+		{
+			"ecs record message",
+			"", false,
+			`{"__CURSOR":"s=1","__REALTIME_TIMESTAMP":"1611096672142532","PRIORITY":"6","_HOSTNAME":"web1","_PID":"1234","_SYSTEMD_UNIT":"api.service","MESSAGE":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",\"ecs\":{\"version\":\"1.5.0\"},\"message\":\"hi\"}"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO (api.service on web1): hi\n    process.pid: 1234\n",
+		},
+		{
+			"service.name and @timestamp are only mapped if missing",
+			"", false,
+			`{"__REALTIME_TIMESTAMP":"1611096672142532","_HOSTNAME":"web1","_PID":"1234","_SYSTEMD_UNIT":"api.service","MESSAGE":"{\"log.level\":\"info\",\"ecs\":{\"version\":\"1.5.0\"},\"service\":{\"name\":\"api\"},\"host\":{\"hostname\":\"container1\"},\"message\":\"hi\"}"}`,
+			"[2021-01-19T22:51:12.142532Z]  INFO (api on web1): hi\n    process.pid: 1234\n",
+		},
+		{
+			"plain-text message",
+			"", true,
+			`{"__REALTIME_TIMESTAMP":"1611096672142532","PRIORITY":"3","_HOSTNAME":"web1","_PID":"1234","_SYSTEMD_UNIT":"api.service","MESSAGE":"Failed to start API server."}`,
+			"[2021-01-19T22:51:12.142532Z] ERROR (api.service on web1): Failed to start API server.\n    process.pid: 1234\n",
+		},
+		{
+			"non-utf8 message",
+			"", false,
+			`{"__REALTIME_TIMESTAMP":"1611096672142532","MESSAGE":[104,105]}`,
+			"[2021-01-19T22:51:12.142532Z]  INFO: hi\n",
+		},
+		{
+			"filter on mapped fields",
+			"host.hostname:web2 and process.pid:42", false,
+			`{"__REALTIME_TIMESTAMP":"1611096672142532","_HOSTNAME":"web1","_PID":"42","MESSAGE":"one"}
+{"__REALTIME_TIMESTAMP":"1611096673142532","_HOSTNAME":"web2","_PID":"42","MESSAGE":"two"}`,
+			"[2021-01-19T22:51:13.142532Z]  INFO (on web2): two\n    process.pid: 42\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetStrictFilter(tc.strict)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package ecslog
+
+// Support for limiting output to the first (`--head N`) or last (`--tail N`)
+// rendered log records.
+
+import (
+	"bytes"
+	"io"
+)
+
+// SetHeadLimit sets the renderer to stop after rendering `n` log records from
+// an input. Records are counted after all filtering. Zero means no limit.
+func (r *Renderer) SetHeadLimit(n int) {
+	r.headLimit = n
+}
+
+// SetTailLimit sets the renderer to only render the last `n` log records from
+// an input. Records are counted after all filtering. Zero means no limit.
+func (r *Renderer) SetTailLimit(n int) {
+	r.tailLimit = n
+}
+
+// headDone returns true iff the head limit has been reached.
+func (r *Renderer) headDone() bool {
+	if !r.headReached() {
+		return false
+	}
+	// Trailing lines of the last rendered record are still to come.
+	return !(r.groupLines && r.group.open && r.group.kind == itemRecord)
+}
+
+// headReached returns true iff the head limit number of records have been
+// rendered.
+func (r *Renderer) headReached() bool {
+	return r.headLimit > 0 && r.numRendered >= r.headLimit
+}
+
+// tailUnit is a rendered log record and the non-record lines that follow it,
+// or (for the first unit of the input only) non-record lines that precede
+// any record.
+type tailUnit struct {
+	items     []renderItem
+	hasRecord bool
+}
+
+// tailBuffer holds the output for the last `limit` rendered records of an
+// input that cannot be read backwards (e.g. stdin).
+type tailBuffer struct {
+	limit      int
+	units      []tailUnit
+	numRecords int
+}
+
+func (tb *tailBuffer) add(it *renderItem) {
+	if it.kind == itemRecord {
+		tb.units = append(tb.units, tailUnit{items: []renderItem{*it}, hasRecord: true})
+		tb.numRecords++
+		for tb.numRecords > tb.limit {
+			if tb.units[0].hasRecord {
+				tb.numRecords--
+			}
+			tb.units[0] = tailUnit{}
+			tb.units = tb.units[1:]
+		}
+	} else if len(tb.units) == 0 {
+		tb.units = append(tb.units, tailUnit{items: []renderItem{*it}})
+	} else {
+		u := &tb.units[len(tb.units)-1]
+		u.items = append(u.items, *it)
+	}
+}
+
+// flushTail writes any output held for `--tail N` and stops holding output.
+func (r *Renderer) flushTail(out io.Writer) {
+	tb := r.tailBuf
+	if tb == nil {
+		return
+	}
+	r.tailBuf = nil
+	for _, u := range tb.units {
+		for i := range u.items {
+			r.output(&u.items[i], out)
+		}
+	}
+}
+
+// seekToTail positions the input at the start of the last `n` rendered log
+// records. It reads backwards from the end of the input, one block at a time,
+// so that a large log file need not be read from the start. If the input has
+// fewer than `n` matching records, the input is left at its start.
+//
+// A line split into chunks by a container runtime (see
+// processContainerChunk) is processed as a whole, and the input is
+// positioned at its first chunk.
+func (r *Renderer) seekToTail(rs io.ReadSeeker, n int) error {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	blockSize := int64(r.readBufSize())
+	block := make([]byte, blockSize)
+	// carry is the start of the line continued from the following block.
+	// carryLong is true if that line is longer than the read buffer, in which
+	// case it is not processed.
+	var carry []byte
+	var carryLong bool
+	count := 0
+
+	// group is the chunks of a split line, in order, starting at offset
+	// groupStart. Walking backwards, the group is complete at the preceding
+	// line that is not a non-final chunk.
+	var group [][]byte
+	var groupStart int64
+	target := int64(-1)
+	// flushGroup processes the group, counting it if it would be rendered as
+	// a log record.
+	flushGroup := func() {
+		if len(group) == 0 {
+			return
+		}
+		r.partial = &partialLine{}
+		var it renderItem
+		for _, line := range group {
+			it = r.processLine(bytes.TrimSuffix(line, []byte{'\r'}))
+		}
+		group = group[:0]
+		if it.kind == itemRecord {
+			count++
+			if count == n {
+				target = groupStart
+			}
+		}
+	}
+	// addLine adds the line at offset `off`, walking backwards. It returns
+	// true when the target offset has been found.
+	addLine := func(line []byte, off int64, long bool) bool {
+		if final, ok := r.containerChunk(line); long || !ok || final {
+			flushGroup()
+			if target != -1 {
+				return true
+			}
+		}
+		if !long && len(line) > 0 {
+			group = append([][]byte{append([]byte(nil), line...)}, group...)
+			groupStart = off
+		}
+		return false
+	}
+
+	for end := size; end > start; {
+		blockStart := end - blockSize
+		if blockStart < start {
+			blockStart = start
+		}
+		buf := block[:end-blockStart]
+		if _, err = rs.Seek(blockStart, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(rs, buf); err != nil {
+			return err
+		}
+		data := append(buf, carry...)
+
+		// Walk backwards through the complete lines in `data`.
+		segEnd := len(data)
+		for i := len(data) - 1; i >= 0; i-- {
+			if data[i] != '\n' {
+				continue
+			}
+			lineLong := carryLong && segEnd == len(data)
+			if addLine(data[i+1:segEnd], blockStart+int64(i+1), lineLong) {
+				_, err = rs.Seek(target, io.SeekStart)
+				return err
+			}
+			segEnd = i
+		}
+		carryLong = carryLong && segEnd == len(data)
+
+		// The line at the start of the block continues in the preceding
+		// block, unless this is the start of the input.
+		if blockStart == start {
+			addLine(data[:segEnd], start, carryLong)
+			flushGroup()
+			if target != -1 {
+				_, err = rs.Seek(target, io.SeekStart)
+				return err
+			}
+		} else if carryLong || int64(segEnd) > blockSize {
+			carry = carry[:0]
+			carryLong = true
+		} else {
+			carry = append(carry[:0:0], data[:segEnd]...)
+		}
+		end = blockStart
+	}
+
+	_, err = rs.Seek(start, io.SeekStart)
+	return err
+}
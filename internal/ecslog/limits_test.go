@@ -0,0 +1,186 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestHeadTailLimits(t *testing.T) {
+	log := `leading line
+{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"one"}
+{"log.level":"debug","@timestamp":"2021-01-19T22:51:13.142Z","ecs":{"version":"1.5.0"},"message":"two"}
+a stack trace line
+{"log.level":"info","@timestamp":"2021-01-19T22:51:14.142Z","ecs":{"version":"1.5.0"},"message":"three"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:15.142Z","ecs":{"version":"1.5.0"},"message":"four"}
+trailing line
+`
+	testCases := []struct {
+		name  string
+		head  int
+		tail  int
+		level string
+		want  string
+	}{
+		{
+			"head",
+			2, 0, "",
+			"leading line\n INFO: one\nDEBUG: two\n",
+		},
+		{
+			"head after filtering",
+			2, 0, "info",
+			"leading line\n INFO: one\na stack trace line\n INFO: three\n",
+		},
+		{
+			"head more than records",
+			10, 0, "",
+			"leading line\n INFO: one\nDEBUG: two\na stack trace line\n INFO: three\n INFO: four\ntrailing line\n",
+		},
+		{
+			"tail",
+			0, 2, "",
+			" INFO: three\n INFO: four\ntrailing line\n",
+		},
+		{
+			"tail after filtering",
+			0, 2, "info",
+			" INFO: three\n INFO: four\ntrailing line\n",
+		},
+		{
+			"tail with non-record lines",
+			0, 3, "",
+			"DEBUG: two\na stack trace line\n INFO: three\n INFO: four\ntrailing line\n",
+		},
+		{
+			"tail more than records",
+			0, 10, "",
+			"leading line\n INFO: one\nDEBUG: two\na stack trace line\n INFO: three\n INFO: four\ntrailing line\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A seekable input (read backwards for `--tail`) and a
+			// non-seekable input should render the same.
+			inputs := map[string]io.Reader{
+				"seekable":     strings.NewReader(log),
+				"non-seekable": bytes.NewBufferString(log),
+			}
+			for inName, in := range inputs {
+				r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.SetLevelFilter(tc.level)
+				r.SetHeadLimit(tc.head)
+				r.SetTailLimit(tc.tail)
+				var out bytes.Buffer
+				if err = r.RenderFile(in, &out); err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+					t.Errorf("%s: r.RenderFile() mismatch (-want +got):\n%s", inName, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestTailLimitReadsBackwards(t *testing.T) {
+	start := time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC)
+	log := timeSortedLog(start, 100000)
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTailLimit(3)
+
+	in := &countingReadSeeker{ReadSeeker: strings.NewReader(log)}
+	var out bytes.Buffer
+	if err := r.RenderFile(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := " INFO: record 99997\n INFO: record 99998\n INFO: record 99999\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+	if in.n > len(log)/10 {
+		t.Errorf("r.RenderFile() read %d bytes of %d byte seekable input, expected to read from the end", in.n, len(log))
+	}
+}
+
+func TestTailLimitLongLines(t *testing.T) {
+	// Lines longer than the read buffer span the blocks read backwards.
+	long := strings.Repeat("x", 100000)
+	var b strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&b, `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"record %d"}`+"\n", i)
+		b.WriteString(long + "\n")
+	}
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTailLimit(2)
+	var out bytes.Buffer
+	if err := r.RenderFile(strings.NewReader(b.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := " INFO: record 3\n" + long + "\n INFO: record 4\n" + long + "\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTailLimitMultilineJSON(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&b, "{\n  \"log.level\": \"info\",\n  \"@timestamp\": \"2021-01-19T22:51:12.142Z\",\n  \"ecs.version\": \"1.6.0\",\n  \"message\": \"record %d\"\n}\n", i)
+	}
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetMultilineJSON(true)
+	r.SetTailLimit(2)
+	var out bytes.Buffer
+	if err := r.RenderFile(strings.NewReader(b.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := " INFO: record 3\n INFO: record 4\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTailLimitSplitLines(t *testing.T) {
+	// The last records are split into chunks by a container runtime, and
+	// span the blocks read backwards.
+	for _, runtime := range []string{"docker", "cri"} {
+		log := containerSplitLog(runtime, time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC), 5000)
+		for _, n := range []int{1, 2, 100, 1234} {
+			r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetTailLimit(n)
+			var out bytes.Buffer
+			if err := r.RenderFile(strings.NewReader(log), &out); err != nil {
+				t.Fatal(err)
+			}
+			var want strings.Builder
+			for i := 5000 - n; i < 5000; i++ {
+				fmt.Fprintf(&want, " INFO: record %d\n", i)
+			}
+			if diff := cmp.Diff(want.String(), out.String()); diff != "" {
+				t.Errorf("%s, tail %d: r.RenderFile() mismatch (-want +got):\n%s", runtime, n, diff)
+			}
+		}
+	}
+}
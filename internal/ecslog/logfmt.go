@@ -0,0 +1,150 @@
+package ecslog
+
+// Support for rendering logfmt log lines (https://brandur.org/logfmt), e.g.:
+//
+//    time=2021-01-19T22:51:12Z level=info msg="listening" addr=:8080
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+
+	"github.com/trentm/go-ecslog/internal/lg"
+	"github.com/valyala/fastjson"
+)
+
+// logfmtNumberRe matches unquoted logfmt values that are decoded as JSON
+// numbers.
+var logfmtNumberRe = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// logfmtRecordKeys are the logfmt keys of which a line must have at least one
+// (or the "from" field of a field mapping) to possibly be a log record: the
+// ECS fields required of an ecs-logging record, and the fields that a record
+// adapter converts to them (see `adaptRecord`).
+var logfmtRecordKeys = map[string]bool{
+	"@timestamp":  true,
+	"log.level":   true,
+	"ecs.version": true,
+	"level":       true,
+	"time":        true,
+	"ts":          true,
+}
+
+// mayBeLogfmtRecord returns true iff the line has a `key=value` pair with a
+// key that is needed for it to be a log record. This is a quick check, so
+// that plain-text lines are not decoded only to be passed through.
+func (r *Renderer) mayBeLogfmtRecord(line []byte) bool {
+	for {
+		eq := bytes.IndexByte(line, '=')
+		if eq == -1 {
+			return false
+		}
+		start := eq
+		for start > 0 && line[start-1] > ' ' {
+			start--
+		}
+		if r.isLogfmtRecordKey(line[start:eq]) {
+			return true
+		}
+		line = line[eq+1:]
+	}
+}
+
+func (r *Renderer) isLogfmtRecordKey(key []byte) bool {
+	if logfmtRecordKeys[string(key)] {
+		return true
+	}
+	for i := range r.fieldMappings {
+		if r.fieldMappings[i].fromKey == string(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLogfmt decodes a logfmt line into a record, with a field for each
+// `key=value` pair. Keys are used as is, so a dotted key such as
+// `log.level=info` is an ECS field. Values are strings, except that unquoted
+// numbers are decoded as numbers, and a key without a value (e.g. `debug`)
+// is decoded as `true`. Quoted values may use Go string escapes, e.g. `\"`.
+//
+// It returns nil if the line is not a well-formed logfmt line with at least
+// one `key=value` pair.
+func (r *Renderer) parseLogfmt(line []byte) *fastjson.Value {
+	r.arena.Reset()
+	rec := r.arena.NewObject()
+	numPairs := 0
+	i := 0
+	for {
+		for i < len(line) && line[i] <= ' ' {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] > ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		if i == start {
+			lg.Printf("logfmt parse error: missing key at offset %d\n", i)
+			return nil
+		}
+		key := string(line[start:i])
+		if i == len(line) || line[i] <= ' ' {
+			rec.Set(key, r.arena.NewTrue())
+			continue
+		} else if line[i] == '"' {
+			lg.Printf("logfmt parse error: unexpected '\"' in key at offset %d\n", i)
+			return nil
+		}
+		i++ // Skip the '='.
+
+		if i < len(line) && line[i] == '"' {
+			start = i
+			i++
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(line) {
+				lg.Printf("logfmt parse error: unterminated quoted value at offset %d\n", start)
+				return nil
+			}
+			i++ // Skip the closing '"'.
+			if i < len(line) && line[i] > ' ' {
+				lg.Printf("logfmt parse error: unexpected %q after quoted value at offset %d\n", line[i], i)
+				return nil
+			}
+			val, err := strconv.Unquote(string(line[start:i]))
+			if err != nil {
+				lg.Printf("logfmt parse error: invalid quoted value at offset %d: %s\n", start, err)
+				return nil
+			}
+			rec.Set(key, r.arena.NewString(val))
+		} else {
+			start = i
+			for i < len(line) && line[i] > ' ' {
+				if line[i] == '=' || line[i] == '"' {
+					lg.Printf("logfmt parse error: unexpected %q in value at offset %d\n", line[i], i)
+					return nil
+				}
+				i++
+			}
+			val := line[start:i]
+			if logfmtNumberRe.Match(val) {
+				rec.Set(key, r.arena.NewNumberString(string(val)))
+			} else {
+				rec.Set(key, r.arena.NewStringBytes(val))
+			}
+		}
+		numPairs++
+	}
+	if numPairs == 0 {
+		return nil
+	}
+	return rec
+}
@@ -0,0 +1,112 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestLogfmt(t *testing.T) {
+	testCases := []struct {
+		name       string
+		formatName string
+		level      string
+		kql        string
+		input      string
+		want       string
+	}{
+		{
+			"ecs fields",
+			"ecs", "", "",
+			`@timestamp=2021-01-19T22:51:12.142Z log.level=info ecs.version=1.6.0 message="hi there" n=5 ratio=-0.5e3 port=:8080 id=007 ok`,
+			`{"@timestamp":"2021-01-19T22:51:12.142Z","log.level":"info","ecs.version":"1.6.0","message":"hi there","n":5,"ratio":-0.5e3,"port":":8080","id":"007","ok":true}` + "\n",
+		},
+		{
+			"escapes",
+			"ecs", "", "",
+			`@timestamp=2021-01-19T22:51:12.142Z log.level=info ecs.version=1.6.0 message="say \"hi\"\tnow" path="C:\\tmp" empty= quoted_empty=""`,
+			`{"@timestamp":"2021-01-19T22:51:12.142Z","log.level":"info","ecs.version":"1.6.0","message":"say \"hi\"\tnow","path":"C:\\tmp","empty":"","quoted_empty":""}` + "\n",
+		},
+		{
+			"default format",
+			"default", "", "",
+			`time=2021-01-19T22:51:12Z level=warning msg="disk almost full" service.name=store free_bytes=1024`,
+			"[2021-01-19T22:51:12Z] WARNING (store): disk almost full\n    free_bytes: 1024\n",
+		},
+		{
+			"go-kit",
+			"default", "", "",
+			`ts=2021-01-19T22:51:12.142Z caller=main.go:42 level=info msg="Starting Prometheus"`,
+			"[2021-01-19T22:51:12.142Z]  INFO: Starting Prometheus\n" +
+				"    log.origin: {\n" +
+				"        \"file\": {\n" +
+				"            \"name\": \"main.go\",\n" +
+				"            \"line\": 42\n" +
+				"        }\n" +
+				"    }\n",
+		},
+		{
+			"filters",
+			"simple", "info", "http.response.status_code >= 500",
+			`time=2021-01-19T22:51:12Z level=info msg=ok http.response.status_code=200
+time=2021-01-19T22:51:13Z level=error msg=oops http.response.status_code=503
+time=2021-01-19T22:51:14Z level=debug msg=oops http.response.status_code=500`,
+			"ERROR: oops …\n",
+		},
+		{
+			"non-logfmt lines",
+			"simple", "", "",
+			"Starting server on port 8080\n" +
+				"a=b\n" +
+				"level=info msg=hi\n" +
+				"\n",
+			"Starting server on port 8080\na=b\nlevel=info msg=hi\n\n",
+		},
+		{
+			"malformed pairs",
+			"simple", "", "",
+			`time=2021-01-19T22:51:12Z level=info msg=first
+time=2021-01-19T22:51:12Z level=info msg="unterminated
+time=2021-01-19T22:51:12Z level=info msg="trailing"junk
+time=2021-01-19T22:51:12Z level=info msg=un"quoted
+time=2021-01-19T22:51:12Z level=info msg=a=b
+time=2021-01-19T22:51:12Z level=info =value msg=no-key
+time=2021-01-19T22:51:12Z level=info ke"y=value msg=quote-in-key
+time=2021-01-19T22:51:12Z level=info msg="bad escape \q"
+time=2021-01-19T22:51:12Z level=info msg="escaped quote at end\"
+time=2021-01-19T22:51:12Z level=info msg=last`,
+			` INFO: first
+time=2021-01-19T22:51:12Z level=info msg="unterminated
+time=2021-01-19T22:51:12Z level=info msg="trailing"junk
+time=2021-01-19T22:51:12Z level=info msg=un"quoted
+time=2021-01-19T22:51:12Z level=info msg=a=b
+time=2021-01-19T22:51:12Z level=info =value msg=no-key
+time=2021-01-19T22:51:12Z level=info ke"y=value msg=quote-in-key
+time=2021-01-19T22:51:12Z level=info msg="bad escape \q"
+time=2021-01-19T22:51:12Z level=info msg="escaped quote at end\"
+ INFO: last
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetLevelFilter(tc.level)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
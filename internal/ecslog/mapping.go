@@ -0,0 +1,115 @@
+package ecslog
+
+// Support for user-defined field mappings, e.g. to render records from a
+// logger that uses "severity" rather than "log.level".
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/trentm/go-ecslog/internal/kqlog"
+	"github.com/valyala/fastjson"
+)
+
+// FieldMapping is a rule to move a field of each record to another field
+// name, e.g. from "severity" to "log.level".
+type FieldMapping struct {
+	From string // the dotted name of the field to move
+	To   string // the dotted name to move it to; this may be the same as From
+	// Values, if set, maps field values to new (string) values, e.g.
+	// "WARNING" to "warn". A string field value is looked up as is, and other
+	// values by their JSON representation, e.g. "30". Values that are not in
+	// the map are not changed.
+	Values map[string]string
+	// When, if set, is a KQL query that a record must match for the mapping
+	// to apply, e.g. "service.name:billing".
+	When string
+}
+
+// fieldMapping is a FieldMapping prepared for applying to records.
+type fieldMapping struct {
+	fromKey string // the "from" field name, e.g. "a.b"
+	from    []string
+	to      []string
+	values  map[string]string
+	when    *kqlog.Filter
+	whenKQL string // the source of when
+}
+
+// SetFieldMappings sets the field mappings to apply, in order, to each
+// parsed record before checking if it is an ecs-logging record.
+func (r *Renderer) SetFieldMappings(mappings []FieldMapping) error {
+	r.fieldMappings = nil
+	for i, m := range mappings {
+		if m.From == "" || m.To == "" {
+			return fmt.Errorf("invalid field mapping %d: 'from' and 'to' are required", i+1)
+		}
+		fm := fieldMapping{
+			fromKey: m.From,
+			from:    strings.Split(m.From, "."),
+			to:      strings.Split(m.To, "."),
+			values:  m.Values,
+		}
+		if m.When != "" {
+			when, err := kqlog.NewFilter(m.When, LogLevelLess)
+			if err != nil {
+				return fmt.Errorf("invalid field mapping %d: invalid 'when' KQL: %s", i+1, err)
+			}
+			fm.when = when
+			fm.whenKQL = m.When
+		}
+		r.fieldMappings = append(r.fieldMappings, fm)
+	}
+	return nil
+}
+
+// applyFieldMappings applies the field mappings to the record. It returns
+// true if the record was changed.
+//
+// A field is not moved if the record already has a field with the new name.
+func (r *Renderer) applyFieldMappings(rec *fastjson.Value) bool {
+	changed := false
+	for i := range r.fieldMappings {
+		m := &r.fieldMappings[i]
+		v := jsonutils.LookupValue(rec, m.from...)
+		if v == nil {
+			continue
+		}
+		if m.when != nil && !m.when.Match(rec) {
+			continue
+		}
+		if m.values != nil {
+			var key string
+			if v.Type() == fastjson.TypeString {
+				key = string(v.GetStringBytes())
+			} else {
+				key = v.String()
+			}
+			if newVal, ok := m.values[key]; ok {
+				v = r.arena.NewString(newVal)
+			}
+		}
+		if !equalLookup(m.from, m.to) {
+			if jsonutils.LookupValue(rec, m.to...) != nil {
+				continue
+			}
+			jsonutils.ExtractValue(rec, m.from...)
+		}
+		jsonutils.SetValue(rec, v, m.to...)
+		changed = true
+	}
+	return changed
+}
+
+func equalLookup(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
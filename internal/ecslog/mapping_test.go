@@ -0,0 +1,139 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestFieldMappings(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mappings   []ecslog.FieldMapping
+		formatName string
+		kql        string
+		input      string
+		want       string
+	}{
+		{
+			"rename",
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level"},
+				{From: "logger_name", To: "log.logger"},
+				{From: "ts", To: "@timestamp"},
+			},
+			"default", "",
+			`{"severity":"warn","ts":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.6.0"},"logger_name":"db","message":"hi"}`,
+			"[2021-01-19T22:51:12.142Z]  WARN (db): hi\n",
+		},
+		{
+			"value map",
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level", Values: map[string]string{"WARNING": "warn", "30": "info"}},
+			},
+			"simple", "log.level >= warn",
+			`{"severity":"WARNING","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"mapped"}
+{"severity":30,"@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"number"}
+{"severity":"error","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"unmapped"}`,
+			" WARN: mapped\nERROR: unmapped\n",
+		},
+		{
+			"value map in place",
+			[]ecslog.FieldMapping{
+				{From: "log.level", To: "log.level", Values: map[string]string{"W": "warn"}},
+			},
+			"simple", "",
+			`{"log":{"level":"W"},"@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"nested"}`,
+			" WARN: nested\n",
+		},
+		{
+			"scoped with when",
+			[]ecslog.FieldMapping{
+				{From: "name", To: "service.name", When: "kind:app"},
+			},
+			"default", "",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","kind":"app","name":"billing","message":"app"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","kind":"user","name":"bob","message":"user"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO (billing): app\n    kind: \"app\"\n" +
+				"[2021-01-19T22:51:12.142Z]  INFO: user\n    kind: \"user\"\n    name: \"bob\"\n",
+		},
+		{
+			"existing field is not replaced",
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level"},
+			},
+			"default", "",
+			`{"log.level":"info","severity":"debug","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi\n    severity: \"debug\"\n",
+		},
+		{
+			"ecs format renders mapped record",
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level", Values: map[string]string{"WARNING": "warn"}},
+			},
+			"ecs", "",
+			`{"severity":"WARNING","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}`,
+			`{"@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","log.level":"warn"}` + "\n",
+		},
+		{
+			"logfmt line",
+			[]ecslog.FieldMapping{
+				{From: "severity", To: "log.level"},
+				{From: "at", To: "@timestamp"},
+				{From: "v", To: "ecs.version"},
+			},
+			"simple", "",
+			`at=2021-01-19T22:51:12.142Z severity=warn v=1.6.0 message=hi`,
+			" WARN: hi\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetFieldMappings(tc.mappings); err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetFieldMappingsErrors(t *testing.T) {
+	testCases := []struct {
+		mappings []ecslog.FieldMapping
+		want     string
+	}{
+		{
+			[]ecslog.FieldMapping{{From: "a", To: "b"}, {From: "severity"}},
+			"invalid field mapping 2: 'from' and 'to' are required",
+		},
+		{
+			[]ecslog.FieldMapping{{From: "a", To: "b", When: "foo:"}},
+			"invalid field mapping 1: invalid 'when' KQL: ",
+		},
+	}
+	for _, tc := range testCases {
+		r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.SetFieldMappings(tc.mappings)
+		if err == nil || !bytes.HasPrefix([]byte(err.Error()), []byte(tc.want)) {
+			t.Errorf("r.SetFieldMappings(%+v) error = %v, want prefix %q", tc.mappings, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package ecslog
+
+// Support for rendering multiple log files merged in "@timestamp" order, like
+// `sort -m` on the parsed timestamp of each record.
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+	"time"
+)
+
+// mergeSource is a single input to a merge. Its records are read in "units":
+// a log record followed by any non-record lines that follow it in the input.
+// Those following lines stay attached to the record when merged.
+type mergeSource struct {
+	idx       int
+	label     string
+	reader    *bufio.Reader
+	wasPrefix bool
+	partial   partialLine // a partial line from a container runtime
+	eof       bool
+	err       error
+
+	unit     []renderItem // the next unit to be written
+	unitTime time.Time    // the time at which to order `unit`
+	next     *renderItem  // the record item starting the following unit
+	held     *renderItem  // an item read with a flushed item, see readItem
+	lastTime time.Time    // the time of the last unit with a timestamp
+}
+
+// readItem reads and processes the next line from the source. It returns
+// false at the end of input.
+func (s *mergeSource) readItem(r *Renderer) (renderItem, bool) {
+	if s.held != nil {
+		it := *s.held
+		s.held = nil
+		return it, true
+	}
+	line, isPrefix, err := s.reader.ReadLine()
+	if err != nil {
+		s.eof = true
+		if err != io.EOF {
+			s.err = err
+			return renderItem{}, false
+		}
+		r.partial = &s.partial
+		it := r.flushJSONLines()
+		it.source = s.label
+		return it, it.kind != itemNone
+	}
+
+	var it renderItem
+	if s.wasPrefix || isPrefix {
+		it = r.passthroughFragment(line, isPrefix)
+		if s.wasPrefix {
+			// Only label the start of a long line.
+			s.wasPrefix = isPrefix
+			return it, true
+		}
+		s.wasPrefix = isPrefix
+	} else {
+		r.partial = &s.partial
+		it = r.processLine(line)
+	}
+	it.source = s.label
+	if it.flushed != nil {
+		// Return the flushed lines first, so each is ordered separately.
+		flushed := *it.flushed
+		flushed.source = s.label
+		it.flushed = nil
+		s.held = &it
+		return flushed, true
+	}
+	return it, true
+}
+
+// advance reads the next unit from the source into `s.unit`.
+func (s *mergeSource) advance(r *Renderer) {
+	s.unit = s.unit[:0]
+	if s.next != nil {
+		s.unit = append(s.unit, *s.next)
+		s.next = nil
+	}
+	for !s.eof {
+		it, ok := s.readItem(r)
+		if !ok {
+			break
+		} else if it.kind == itemNone {
+			continue
+		} else if it.isRecord() && len(s.unit) > 0 {
+			s.next = &it
+			break
+		}
+		s.unit = append(s.unit, it)
+	}
+
+	// A unit without a parseable timestamp (e.g. non-record lines at the
+	// start of a file) is ordered with the preceding unit from this source.
+	s.unitTime = s.lastTime
+	if len(s.unit) > 0 && s.unit[0].isRecord() {
+		if t, ok := parseTimestamp(s.unit[0].timestamp); ok {
+			s.unitTime = t
+			s.lastTime = t
+		}
+	}
+}
+
+// mergeHeap is a min-heap of merge sources ordered by the time of their
+// next unit. Ties are broken by source order, to be stable.
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].unitTime.Equal(h[j].unitTime) {
+		return h[i].idx < h[j].idx
+	}
+	return h[i].unitTime.Before(h[j].unitTime)
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) {
+	*h = append(*h, x.(*mergeSource))
+}
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	*h = old[:n-1]
+	return s
+}
+
+// RenderMerged renders log records from the given inputs, merged in the
+// order of each record's "@timestamp". Each input is assumed to already be in
+// time order. Non-record lines are kept with the preceding record from the
+// same input. Each line of output is prefixed with the name of its input.
+//
+// The merge streams through the inputs: only the next record from each
+// input is held in memory.
+func (r *Renderer) RenderMerged(ins []io.Reader, names []string, out io.Writer) error {
+	if len(ins) != len(names) {
+		return fmt.Errorf("number of merge inputs (%d) and names (%d) differ",
+			len(ins), len(names))
+	}
+
+	labelWidth := 0
+	for _, name := range names {
+		if len(name) > labelWidth {
+			labelWidth = len(name)
+		}
+	}
+
+	r.numRendered = 0
+	r.resetContext()
+	r.group = groupState{}
+	r.resetTimeRange()
+	if r.tailLimit > 0 {
+		r.tailBuf = &tailBuffer{limit: r.tailLimit}
+		defer r.flushTail(out)
+	}
+
+	var firstErr error
+	bufSize := r.readBufSize()
+	h := make(mergeHeap, 0, len(ins))
+	for i, in := range ins {
+		s := &mergeSource{
+			idx:    i,
+			label:  fmt.Sprintf("%-*s", labelWidth, names[i]),
+			reader: bufio.NewReaderSize(in, bufSize),
+		}
+		s.advance(r)
+		if len(s.unit) > 0 {
+			h = append(h, s)
+		} else if s.err != nil && firstErr == nil {
+			firstErr = s.err
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		s := h[0]
+		for i := range s.unit {
+			r.emit(&s.unit[i], out)
+		}
+		if r.headDone() {
+			break
+		}
+		s.advance(r)
+		if len(s.unit) > 0 {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+			if s.err != nil && firstErr == nil {
+				firstErr = s.err
+			}
+		}
+	}
+	return firstErr
+}
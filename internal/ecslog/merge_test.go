@@ -0,0 +1,89 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestRenderMerged(t *testing.T) {
+	api := strings.Join([]string{
+		`starting api`,
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.000Z","ecs":{"version":"1.5.0"},"message":"api one"}`,
+		`{"log.level":"error","@timestamp":"2021-01-19T22:51:14.000Z","ecs":{"version":"1.5.0"},"message":"api two"}`,
+		`Traceback (most recent call last):`,
+		`  File "api.py", line 42`,
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:16.000Z","ecs":{"version":"1.5.0"},"message":"api three"}`,
+	}, "\n")
+	// This input uses a different time zone offset.
+	worker := strings.Join([]string{
+		`{"log.level":"info","@timestamp":"2021-01-19T23:51:13.000+01:00","ecs":{"version":"1.5.0"},"message":"worker one"}`,
+		`{"log.level":"info","@timestamp":"2021-01-19T23:51:15.000+01:00","ecs":{"version":"1.5.0"},"message":"worker two"}`,
+		`{"log.level":"info","@timestamp":"2021-01-19T23:51:16.000+01:00","ecs":{"version":"1.5.0"},"message":"worker three"}`,
+	}, "\n")
+
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = r.RenderMerged(
+		[]io.Reader{strings.NewReader(api), strings.NewReader(worker)},
+		[]string{"api.log", "worker.log"},
+		&out)
+	if err != nil {
+		t.Fatalf("r.RenderMerged() error: %s", err)
+	}
+
+	want := "api.log    | starting api\n" +
+		"api.log    | [2021-01-19T22:51:12.000Z]  INFO: api one\n" +
+		"worker.log | [2021-01-19T23:51:13.000+01:00]  INFO: worker one\n" +
+		"api.log    | [2021-01-19T22:51:14.000Z] ERROR: api two\n" +
+		"api.log    | Traceback (most recent call last):\n" +
+		"api.log    |   File \"api.py\", line 42\n" +
+		"worker.log | [2021-01-19T23:51:15.000+01:00]  INFO: worker two\n" +
+		"api.log    | [2021-01-19T22:51:16.000Z]  INFO: api three\n" +
+		"worker.log | [2021-01-19T23:51:16.000+01:00]  INFO: worker three\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderMerged() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenderMergedFiltering(t *testing.T) {
+	a := strings.Join([]string{
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.000Z","ecs":{"version":"1.5.0"},"message":"a one","foo":"bar"}`,
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:14.000Z","ecs":{"version":"1.5.0"},"message":"a two"}`,
+	}, "\n")
+	b := strings.Join([]string{
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:13.000Z","ecs":{"version":"1.5.0"},"message":"b one"}`,
+		`{"log.level":"info","@timestamp":"2021-01-19T22:51:15.000Z","ecs":{"version":"1.5.0"},"message":"b two","foo":"bar"}`,
+	}, "\n")
+
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.SetKQLFilter("foo:bar"); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = r.RenderMerged(
+		[]io.Reader{strings.NewReader(a), strings.NewReader(b)},
+		[]string{"a", "b"},
+		&out)
+	if err != nil {
+		t.Fatalf("r.RenderMerged() error: %s", err)
+	}
+
+	want := "a | [2021-01-19T22:51:12.000Z]  INFO: a one\n" +
+		"a |     foo: \"bar\"\n" +
+		"b | [2021-01-19T22:51:15.000Z]  INFO: b two\n" +
+		"b |     foo: \"bar\"\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderMerged() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,157 @@
+package ecslog
+
+// Support for JSON records that are pretty-printed over multiple lines, e.g.:
+//
+//     {
+//       "log.level": "info",
+//       "@timestamp": "2021-01-19T22:51:12.142Z",
+//       ...
+//     }
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/lg"
+)
+
+// jsonLines accumulates the lines of a multi-line JSON object.
+type jsonLines struct {
+	buf      []byte // the lines so far, joined with newlines
+	depth    int    // nesting depth of objects and arrays at the end of buf
+	inString bool
+	escaped  bool
+	compact  bytes.Buffer
+}
+
+// scan updates the nesting state with the next line of the object. It returns
+// true if the object is complete (or the nesting is unbalanced) at the end of
+// the line.
+func (j *jsonLines) scan(line []byte) bool {
+	for _, c := range line {
+		if j.inString {
+			if j.escaped {
+				j.escaped = false
+			} else if c == '\\' {
+				j.escaped = true
+			} else if c == '"' {
+				j.inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			j.inString = true
+		case '{', '[':
+			j.depth++
+		case '}', ']':
+			j.depth--
+		}
+	}
+	return j.depth <= 0
+}
+
+// canContinue returns false if `line` cannot be the next line of the buffered
+// object. That is, if the object so far has an unterminated string, or the
+// line starts a new top-level object (e.g. a single-line record after a
+// stray "{" line), or the line does not start with a JSON token.
+func (j *jsonLines) canContinue(line []byte) bool {
+	if j.inString {
+		// JSON strings cannot span lines.
+		return false
+	}
+	if len(line) > 0 && line[0] == '{' {
+		return false
+	}
+	trimmed := bytes.TrimLeft(line, " \t\r")
+	if len(trimmed) == 0 {
+		return true
+	}
+	return strings.IndexByte(`"{}[],:-0123456789tfn`, trimmed[0]) != -1
+}
+
+func (j *jsonLines) reset() {
+	j.buf = j.buf[:0]
+	j.depth = 0
+	j.inString = false
+	j.escaped = false
+}
+
+// SetMultilineJSON tells the renderer whether to recognize JSON objects that
+// span multiple input lines. A line that starts with "{" and does not
+// complete a JSON object starts a multi-line object, and following lines are
+// buffered until the object is complete. If the object is not complete within
+// `maxLineLen` bytes, or is not valid JSON, or a line cannot continue the
+// object (e.g. another line starting with "{"), the buffered lines are passed
+// through unchanged.
+func (r *Renderer) SetMultilineJSON(multilineJSON bool) {
+	r.multilineJSON = multilineJSON
+}
+
+// processJSONLine processes an input line when multi-line JSON objects are
+// enabled. It returns false if the line is not part of a multi-line object,
+// in which case it should be processed as usual.
+func (r *Renderer) processJSONLine(line []byte) (renderItem, bool) {
+	j := &r.partial.json
+	if len(j.buf) == 0 {
+		if len(line) == 0 || line[0] != '{' || j.scan(line) {
+			j.reset()
+			return renderItem{}, false
+		}
+		j.buf = append(j.buf, line...)
+		return renderItem{kind: itemNone, tsIdx: -1}, true
+	}
+
+	if !j.canContinue(line) {
+		// The buffered lines are not the start of an object after all. Pass
+		// them through, and process this line as usual.
+		flushed := r.passthrough(j.buf)
+		j.reset()
+		it := r.processLine(line)
+		it.flushed = &flushed
+		return it, true
+	}
+	if len(j.buf)+1+len(line) > r.maxLineLen {
+		// Too long to be a log record.
+		j.buf = append(append(j.buf, '\n'), line...)
+		it := r.passthrough(j.buf)
+		j.reset()
+		return it, true
+	}
+	j.buf = append(append(j.buf, '\n'), line...)
+	if !j.scan(line) {
+		return renderItem{kind: itemNone, tsIdx: -1}, true
+	}
+
+	// The object is complete. Process it as a single line, but pass through
+	// the original lines if it is not a log record.
+	lines := j.buf
+	j.buf = nil
+	defer func() {
+		j.buf = lines
+		j.reset()
+	}()
+	j.compact.Reset()
+	if err := json.Compact(&j.compact, lines); err != nil {
+		lg.Printf("multi-line JSON parse error: %s\n", err)
+		return r.passthrough(lines), true
+	}
+	it := r.processLine(j.compact.Bytes())
+	if it.kind == itemPassthrough {
+		it = r.passthrough(lines)
+	}
+	return it, true
+}
+
+// flushJSONLines returns the item for the buffered lines of an incomplete
+// multi-line JSON object at the end of input. They are passed through.
+func (r *Renderer) flushJSONLines() renderItem {
+	j := &r.partial.json
+	if len(j.buf) == 0 {
+		return renderItem{kind: itemNone, tsIdx: -1}
+	}
+	it := r.passthrough(j.buf)
+	j.reset()
+	return it
+}
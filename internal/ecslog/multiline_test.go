@@ -0,0 +1,114 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestMultilineJSON(t *testing.T) {
+	testCases := []struct {
+		name       string
+		maxLineLen int
+		workers    int
+		input      string
+		want       string
+	}{
+		{
+			"pretty-printed record",
+			-1, 1,
+			`{
+  "log.level": "info",
+  "@timestamp": "2021-01-19T22:51:12.142Z",
+  "ecs": {
+    "version": "1.6.0"
+  },
+  "message": "hi {there}",
+  "tags": ["a", "b]"]
+}
+{"log.level":"warn","@timestamp":"2021-01-19T22:51:12.143Z","ecs.version":"1.6.0","message":"one line"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi {there}\n    tags: [\n        \"a\",\n        \"b]\"\n    ]\n" +
+				"[2021-01-19T22:51:12.143Z]  WARN: one line\n",
+		},
+		{
+			"non-ECS object is passed through unchanged",
+			-1, 1,
+			"{\n  \"foo\": \"bar\"\n}\nafter\n",
+			"{\n  \"foo\": \"bar\"\n}\nafter\n",
+		},
+		{
+			"invalid JSON is passed through",
+			-1, 1,
+			"{\n  \"foo\": bar\n}\nafter\n",
+			"{\n  \"foo\": bar\n}\nafter\n",
+		},
+		{
+			"too long is passed through",
+			30, 1,
+			"{\n  \"message\": \"a long message\",\n  \"foo\": 1\n}\nafter\n",
+			"{\n  \"message\": \"a long message\",\n  \"foo\": 1\n}\nafter\n",
+		},
+		{
+			"record after a bad opening line",
+			-1, 1,
+			"{oops\n" +
+				`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}` + "\n" +
+				"{\n  \"log.level\": \"warn\",\n  \"@timestamp\": \"2021-01-19T22:51:12.143Z\",\n  \"ecs.version\": \"1.6.0\",\n  \"message\": \"pretty\"\n}\n",
+			"{oops\n" +
+				"[2021-01-19T22:51:12.142Z]  INFO: hi\n" +
+				"[2021-01-19T22:51:12.143Z]  WARN: pretty\n",
+		},
+		{
+			"record after a bad opening line, parallel",
+			-1, 4,
+			strings.Repeat("{oops\n"+`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}`+"\n", 500),
+			strings.Repeat("{oops\n[2021-01-19T22:51:12.142Z]  INFO: hi\n", 500),
+		},
+		{
+			"line that cannot continue an object",
+			-1, 1,
+			"{\n  \"foo\": 1,\nplain text\n" +
+				`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}` + "\n",
+			"{\n  \"foo\": 1,\nplain text\n" +
+				"[2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"incomplete at end of input",
+			-1, 1,
+			"{\n  \"foo\": [\n",
+			"{\n  \"foo\": [\n",
+		},
+		{
+			"parallel",
+			-1, 4,
+			strings.Repeat(`{
+  "log.level": "info",
+  "@timestamp": "2021-01-19T22:51:12.142Z",
+  "ecs.version": "1.6.0",
+  "message": "hi"
+}
+`, 500),
+			strings.Repeat("[2021-01-19T22:51:12.142Z]  INFO: hi\n", 500),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", "default", tc.maxLineLen, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetMultilineJSON(true)
+			r.SetWorkers(tc.workers)
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
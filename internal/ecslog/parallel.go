@@ -0,0 +1,225 @@
+package ecslog
+
+// Support for processing input lines with a pool of worker goroutines
+// (`ecslog -j N`), while writing output in input order.
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/trentm/go-ecslog/internal/ansipainter"
+	"github.com/trentm/go-ecslog/internal/kqlog"
+	"github.com/valyala/fastjson"
+)
+
+// A batch of input lines is sent to a worker when it has this many lines or
+// bytes, whichever comes first.
+const (
+	batchMaxLines = 512
+	batchMaxBytes = 256 * 1024
+)
+
+// batchLine is the location of an input line in a lineBatch. `fragment` is
+// true if this is a fragment of a line that is too long to be processed
+// (see RenderFile), and `isPrefix` is true if that line continues.
+type batchLine struct {
+	start, end int
+	fragment   bool
+	isPrefix   bool
+}
+
+// lineBatch is a batch of input lines processed by a single worker.
+type lineBatch struct {
+	buf   []byte
+	lines []batchLine
+	items []renderItem // the processed items, one per line
+	// partial is the worker's partial line (see processContainerChunk) at
+	// the end of the batch.
+	partial partialLine
+	done    chan struct{} // closed when the batch has been processed
+}
+
+func (b *lineBatch) line(i int) []byte {
+	return b.buf[b.lines[i].start:b.lines[i].end]
+}
+
+// SetWorkers sets the number of goroutines used by RenderFile to parse,
+// filter, and format input lines. Output is still written in input order.
+// A value of 0 or 1 means lines are processed on the calling goroutine.
+func (r *Renderer) SetWorkers(n int) {
+	r.workers = n
+}
+
+// newWorker returns a copy of the renderer for processing lines on a worker
+// goroutine. The copy shares configuration, but has its own parsing and
+// painting state, and its own KQL filters -- a kqlog.Filter caches parsed
+// values while matching, so cannot be shared between goroutines.
+func (r *Renderer) newWorker() *Renderer {
+	w := &Renderer{}
+	*w = *r
+	w.parser = fastjson.Parser{}
+	w.arena = fastjson.Arena{}
+	painter := *r.painter
+	w.painter = &painter
+	w.plainPainter = ansipainter.New(nil)
+	w.partial = &partialLine{}
+	w.envFields = nil
+	w.envAdded = nil
+	w.adaptedLine = nil
+	w.tailBuf = nil
+	w.ctx = contextState{}
+	w.lastTimestampBuf = nil
+	w.lastTimestamp = nil
+	if r.kqlFilter != nil {
+		// The KQL was already successfully parsed in SetKQLFilter.
+		w.kqlFilter, _ = kqlog.NewFilter(r.kql, LogLevelLess)
+	}
+	if r.fieldMappings != nil {
+		w.fieldMappings = make([]fieldMapping, len(r.fieldMappings))
+		for i, m := range r.fieldMappings {
+			if m.when != nil {
+				m.when, _ = kqlog.NewFilter(m.whenKQL, LogLevelLess)
+			}
+			w.fieldMappings[i] = m
+		}
+	}
+	return w
+}
+
+// processBatch processes all lines in the batch. Each batch is processed
+// independently, starting without a partial line.
+func (r *Renderer) processBatch(b *lineBatch) {
+	b.items = make([]renderItem, len(b.lines))
+	for i, l := range b.lines {
+		if l.fragment {
+			b.items[i] = r.passthroughFragment(b.line(i), l.isPrefix)
+		} else {
+			b.items[i] = r.processLine(b.line(i))
+		}
+	}
+	b.partial.copyFrom(r.partial)
+	r.partial.buf = r.partial.buf[:0]
+	r.partial.long = false
+	r.partial.json.reset()
+}
+
+// readBatches reads input lines into batches, sending each batch to both the
+// `ordered` channel (for writing in order) and the `work` channel (for
+// processing by a worker).
+func (r *Renderer) readBatches(reader *bufio.Reader, ordered, work chan<- *lineBatch, quit <-chan struct{}) error {
+	b := &lineBatch{done: make(chan struct{})}
+	send := func() bool {
+		select {
+		case ordered <- b:
+		case <-quit:
+			return false
+		}
+		select {
+		case work <- b:
+		case <-quit:
+			return false
+		}
+		b = &lineBatch{done: make(chan struct{})}
+		return true
+	}
+
+	var wasPrefix bool
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			if len(b.lines) > 0 {
+				send()
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		start := len(b.buf)
+		b.buf = append(b.buf, line...)
+		b.lines = append(b.lines, batchLine{
+			start:    start,
+			end:      len(b.buf),
+			fragment: wasPrefix || isPrefix,
+			isPrefix: isPrefix,
+		})
+		wasPrefix = isPrefix
+		if len(b.lines) >= batchMaxLines || len(b.buf) >= batchMaxBytes {
+			if !send() {
+				return nil
+			}
+		}
+	}
+}
+
+// renderParallel renders the input with `r.workers` worker goroutines. See
+// RenderFile.
+//
+// Writing the processed items, which includes styling timestamps relative to
+// the preceding record, is done in input order on the calling goroutine.
+func (r *Renderer) renderParallel(reader *bufio.Reader, out io.Writer, stopAfterUntil bool) error {
+	quit := make(chan struct{})
+	work := make(chan *lineBatch)
+	ordered := make(chan *lineBatch, 2*r.workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(quit)
+
+	for i := 0; i < r.workers; i++ {
+		w := r.newWorker()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range work {
+				w.processBatch(b)
+				close(b.done)
+			}
+		}()
+	}
+
+	var readErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(work)
+		defer close(ordered)
+		readErr = r.readBatches(reader, ordered, work, quit)
+	}()
+
+	for b := range ordered {
+		<-b.done
+		useWorkerPartial := false
+		for i := range b.items {
+			it := &b.items[i]
+			if r.partial.pending() {
+				// A worker cannot know that the start of its batch continues
+				// a partial line from the preceding batch, so re-process
+				// those lines here.
+				if l := b.lines[i]; l.fragment {
+					*it = r.passthroughFragment(b.line(i), l.isPrefix)
+				} else {
+					*it = r.processLine(b.line(i))
+				}
+			} else {
+				useWorkerPartial = true
+			}
+
+			if stopAfterUntil && it.kind == itemFiltered && r.pastTimeRange(it.timestamp) {
+				return nil
+			}
+			r.emit(it, out)
+			if r.headDone() {
+				return nil
+			}
+		}
+		if useWorkerPartial {
+			r.partial.copyFrom(&b.partial)
+		}
+	}
+	if readErr == nil {
+		it := r.flushJSONLines()
+		r.emit(&it, out)
+	}
+	return readErr
+}
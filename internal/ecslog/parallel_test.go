@@ -0,0 +1,136 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+// mixedLog returns a log of `n` records, with a mix of levels, non-ecs-logging
+// lines, long lines, and Docker log entries split into chunks.
+func mixedLog(n int) string {
+	levels := []string{"trace", "debug", "info", "warn", "error"}
+	start := time.Date(2021, 1, 19, 22, 51, 12, 0, time.UTC)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(i*i%7919) * time.Millisecond).Format("2006-01-02T15:04:05.000Z07:00")
+		switch {
+		case i%997 == 0:
+			b.WriteString(strings.Repeat("long line ", 10000) + "\n")
+		case i%89 == 0:
+			// A Docker log entry split into chunks.
+			fmt.Fprintf(&b, `{"log":"{\"log.level\":\"info\",\"@timestamp\":\"%s\",","stream":"stdout","time":"%s"}`+"\n", ts, ts)
+			fmt.Fprintf(&b, `{"log":"\"ecs\":{\"version\":\"1.5.0\"},","stream":"stdout","time":"%s"}`+"\n", ts)
+			fmt.Fprintf(&b, `{"log":"\"message\":\"chunked %d\"}\n","stream":"stdout","time":"%s"}`+"\n", i, ts)
+		case i%13 == 0:
+			fmt.Fprintf(&b, "plain line %d\n", i)
+		default:
+			fmt.Fprintf(&b, `{"log.level":"%s","@timestamp":"%s","ecs":{"version":"1.5.0"},"message":"record %d","http":{"request":{"method":"GET"},"response":{"status_code":%d}},"url":{"path":"/api/%d"}}`+"\n",
+				levels[i%len(levels)], ts, i, 200+i%5*100, i)
+		}
+	}
+	return b.String()
+}
+
+func TestRenderFileWorkers(t *testing.T) {
+	log := mixedLog(5000)
+	testCases := []struct {
+		name  string
+		setup func(r *ecslog.Renderer) error
+	}{
+		{"all", func(r *ecslog.Renderer) error { return nil }},
+		{"level", func(r *ecslog.Renderer) error { r.SetLevelFilter("warn"); return nil }},
+		{"kql", func(r *ecslog.Renderer) error { return r.SetKQLFilter("http.response.status_code >= 500") }},
+		{"mapping when", func(r *ecslog.Renderer) error {
+			return r.SetFieldMappings([]ecslog.FieldMapping{{From: "url.path", To: "url.original", When: "http.response.status_code < 300"}})
+		}},
+		{"head", func(r *ecslog.Renderer) error { r.SetHeadLimit(1234); return nil }},
+		{"context", func(r *ecslog.Renderer) error { r.SetLevelFilter("error"); r.SetContext(1, 1); return nil }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			render := func(workers int) string {
+				r, err := ecslog.NewRenderer("yes", "default", "default", -1, []string{}, []string{}, false, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = tc.setup(r); err != nil {
+					t.Fatal(err)
+				}
+				r.SetWorkers(workers)
+				var out bytes.Buffer
+				if err = r.RenderFile(bytes.NewBufferString(log), &out); err != nil {
+					t.Fatal(err)
+				}
+				return out.String()
+			}
+			want := render(1)
+			got := render(4)
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("r.RenderFile() with workers mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRenderFileWorkersChunksAcrossBatches(t *testing.T) {
+	// Lines are processed in batches of 512 lines, so put Docker log entry
+	// chunks around each multiple of 512 lines.
+	var b strings.Builder
+	for i := 0; i < 2000; i++ {
+		if i%512 == 510 {
+			b.WriteString(`{"log":"{\"log.level\":\"info\",\"@timestamp\":\"2021-01-19T22:51:12.142Z\",","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}` + "\n")
+			b.WriteString(`{"log":"\"ecs\":{\"version\":\"1.5.0\"},","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}` + "\n")
+			fmt.Fprintf(&b, `{"log":"\"message\":\"chunked %d\"}\n","stream":"stdout","time":"2021-01-19T22:51:12.142532Z"}`+"\n", i)
+		} else {
+			fmt.Fprintf(&b, `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"record %d"}`+"\n", i)
+		}
+	}
+	log := b.String()
+
+	render := func(workers int) string {
+		r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetWorkers(workers)
+		var out bytes.Buffer
+		if err = r.RenderFile(bytes.NewBufferString(log), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	want := render(1)
+	if !strings.Contains(want, " INFO: chunked 1022\n") {
+		t.Fatalf("unexpected sequential output: %q", want[:200])
+	}
+	if diff := cmp.Diff(want, render(3)); diff != "" {
+		t.Errorf("r.RenderFile() with workers mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func BenchmarkRenderFile(b *testing.B) {
+	log := []byte(mixedLog(20000))
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("j=%d", workers), func(b *testing.B) {
+			r, err := ecslog.NewRenderer("yes", "default", "default", -1, []string{}, []string{}, false, true)
+			if err != nil {
+				b.Fatal(err)
+			}
+			r.SetWorkers(workers)
+			b.SetBytes(int64(len(log)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err = r.RenderFile(bytes.NewReader(log), ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
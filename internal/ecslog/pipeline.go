@@ -0,0 +1,28 @@
+package ecslog
+
+// Support for processing records with an Elasticsearch ingest pipeline.
+
+import (
+	"github.com/trentm/go-ecslog/internal/ingest"
+	"github.com/trentm/go-ecslog/internal/lg"
+	"github.com/valyala/fastjson"
+)
+
+// SetPipeline sets an ingest pipeline to run on each record before it is
+// checked, filtered, and formatted. With a pipeline, a plain-text input line
+// is processed as a record with just a "message" field (as Filebeat would
+// ship it), rather than being parsed as logfmt or an access log line.
+func (r *Renderer) SetPipeline(p *ingest.Pipeline) {
+	r.pipeline = p
+}
+
+// runPipeline runs the ingest pipeline, if any, on the record. It returns
+// false if the pipeline failed, in which case Elasticsearch would have
+// rejected the record.
+func (r *Renderer) runPipeline(rec *fastjson.Value) bool {
+	if err := r.pipeline.Run(rec, &r.arena); err != nil {
+		lg.Printf("ingest pipeline error: %s\n", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+	"github.com/trentm/go-ecslog/internal/ingest"
+)
+
+func TestPipeline(t *testing.T) {
+	testCases := []struct {
+		name       string
+		pipeline   string
+		formatName string
+		kql        string
+		input      string
+		want       string
+	}{
+		{
+			"grok plain-text lines",
+			`{"processors": [
+				{"grok": {"field": "message", "patterns": ["^%{TIMESTAMP_ISO8601:@timestamp} %{LOGLEVEL:log.level} %{GREEDYDATA:message}$"]}},
+				{"lowercase": {"field": "log.level"}},
+				{"set": {"field": "ecs.version", "value": "1.6.0"}}
+			]}`,
+			"default", "",
+			"2021-01-19T22:51:12.142Z INFO started\n" +
+				"2021-01-19T22:51:12.143Z ERROR disk full\n" +
+				"not a log line\n",
+			"[2021-01-19T22:51:12.142Z]  INFO: started\n" +
+				"[2021-01-19T22:51:12.143Z] ERROR: disk full\n" +
+				"not a log line\n",
+		},
+		{
+			"filtering is after processing",
+			`{"processors": [
+				{"rename": {"field": "severity", "target_field": "log.level"}},
+				{"set": {"field": "labels.slow", "value": true, "if": "ctx.took > 1000"}}
+			]}`,
+			"simple", "labels.slow:true",
+			`{"severity":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","took":20,"message":"fast"}
+{"severity":"warn","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","took":2000,"message":"slow"}`,
+			" WARN: slow …\n",
+		},
+		{
+			"failed record is passed through",
+			`{"processors": [{"convert": {"field": "took", "type": "integer"}}]}`,
+			"simple", "",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","took":"20","message":"ok"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","took":"lots","message":"bad"}`,
+			` INFO: ok …
+{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","took":"lots","message":"bad"}
+`,
+		},
+		{
+			"ecs format renders processed record",
+			`{"processors": [{"remove": {"field": "secret"}}]}`,
+			"ecs", "",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","secret":"x","message":"hi"}`,
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi"}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ingest.Load([]byte(tc.pipeline))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetPipeline(p)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package ecslog
+
+// Support for stripping a prefix from log lines, e.g. as added by
+// `kubectl logs --prefix`, `docker compose logs`, or `docker logs -t`.
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// maxLinePrefixes is the maximum number of prefixes that are stripped from a
+// single line, e.g. a `docker compose logs` prefix followed by a timestamp.
+const maxLinePrefixes = 3
+
+// linePrefix is a recognizer for a prefix on log lines.
+type linePrefix struct {
+	re *regexp.Regexp // must be anchored at the start of the line
+	// fieldFromGroup maps a named capture group to the field name to use for
+	// filtering on the captured value. If nil, group names are used.
+	fieldFromGroup map[string]string
+}
+
+// builtinLinePrefixes are the prefixes that are always recognized.
+var builtinLinePrefixes = []linePrefix{
+	// `kubectl logs --prefix`, e.g. "[pod/api-7f9c/api] "
+	{
+		re: regexp.MustCompile(`^\[pod/(?P<pod>[^/\]\s]+)/(?P<container>[^\]\s]+)\] `),
+		fieldFromGroup: map[string]string{
+			"pod":       "kubernetes.pod.name",
+			"container": "kubernetes.container.name",
+		},
+	},
+	// `docker compose logs`, e.g. "web-1  | "
+	{
+		re: regexp.MustCompile(`^(?P<container>[a-zA-Z0-9][a-zA-Z0-9_.-]*) +\| `),
+		fieldFromGroup: map[string]string{
+			"container": "container.name",
+		},
+	},
+	// `docker logs -t`, e.g. "2021-01-19T22:51:12.142532000Z "
+	{
+		re: regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(\.\d+)?(Z|[+-]\d\d:\d\d) `),
+	},
+}
+
+// SetLinePrefixRegex sets a regular expression for a prefix to strip from
+// log lines, in addition to the built-in prefixes. The regex must match at
+// the start of the line. Named capture groups become fields that can be used
+// for KQL filtering.
+func (r *Renderer) SetLinePrefixRegex(s string) error {
+	if s == "" {
+		r.linePrefixes = builtinLinePrefixes
+		return nil
+	}
+	re, err := regexp.Compile(`^(?:` + s + `)`)
+	if err != nil {
+		return fmt.Errorf("invalid line prefix regex: %s", err)
+	}
+	r.linePrefixes = append([]linePrefix{{re: re}}, builtinLinePrefixes...)
+	return nil
+}
+
+// matchLinePrefix returns the length of the prefix on the line before a JSON
+// object, and any fields captured from that prefix. It returns false if the
+// line does not have a recognized prefix.
+func (r *Renderer) matchLinePrefix(line []byte) (int, []envelopeField, bool) {
+	if bytes.IndexByte(line, '{') <= 0 {
+		return 0, nil, false
+	}
+	var fields []envelopeField
+	n := 0
+	for i := 0; i < maxLinePrefixes && n < len(line) && line[n] != '{'; i++ {
+		matched := false
+		for _, lp := range r.linePrefixes {
+			loc := lp.re.FindSubmatchIndex(line[n:])
+			if loc == nil || loc[1] == 0 {
+				continue
+			}
+			for j, name := range lp.re.SubexpNames() {
+				if name == "" || loc[2*j] == -1 {
+					continue
+				}
+				key := name
+				if lp.fieldFromGroup != nil {
+					key = lp.fieldFromGroup[name]
+				}
+				if key == "" {
+					continue
+				}
+				fields = append(fields, envelopeField{key: key,
+					value: string(line[n+loc[2*j] : n+loc[2*j+1]])})
+			}
+			n += loc[1]
+			matched = true
+			break
+		}
+		if !matched {
+			break
+		}
+	}
+	if n == 0 || n >= len(line) || line[n] != '{' {
+		return 0, nil, false
+	}
+	return n, fields, true
+}
@@ -0,0 +1,109 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestLinePrefix(t *testing.T) {
+	rec := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs":{"version":"1.5.0"},"message":"hi"}`
+	testCases := []struct {
+		name           string
+		shouldColorize string
+		prefixRegex    string
+		kql            string
+		input          string
+		want           string
+	}{
+		{
+			"kubectl logs --prefix",
+			"no", "", "",
+			"[pod/api-7f9c/api] " + rec,
+			"[pod/api-7f9c/api] [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"docker compose logs",
+			"no", "", "",
+			"web-1  | " + rec,
+			"web-1  | [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"docker logs -t",
+			"no", "", "",
+			"2021-01-19T22:51:12.142532000Z " + rec,
+			"2021-01-19T22:51:12.142532000Z [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"docker compose logs -t",
+			"no", "", "",
+			"web-1  | 2021-01-19T22:51:12.142532000Z " + rec,
+			"web-1  | 2021-01-19T22:51:12.142532000Z [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"prefixed non-record is passed through",
+			"no", "", "",
+			"web-1  | {not json\n" +
+				"web-1  | starting up",
+			"web-1  | {not json\nweb-1  | starting up\n",
+		},
+		{
+			"filter on kubectl prefix fields",
+			"no", "", "kubernetes.pod.name:api-* and kubernetes.container.name:api",
+			"[pod/api-7f9c/api] " + rec + "\n" +
+				"[pod/web-1234/web] " + rec,
+			"[pod/api-7f9c/api] [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"filter on docker compose prefix fields",
+			"no", "", "container.name:web-2",
+			"web-1  | " + rec + "\n" +
+				"web-2  | " + rec,
+			"web-2  | [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"custom prefix regex",
+			"no", `(?P<host>[a-z0-9-]+): `, "host:db-1",
+			"web-1: " + rec + "\n" +
+				"db-1: " + rec,
+			"db-1: [2021-01-19T22:51:12.142Z]  INFO: hi\n",
+		},
+		{
+			"prefix is colored",
+			"yes", "", "",
+			"web-1  | " + rec,
+			"\x1b[35mweb-1  | \x1b[0m[2021-01-19T22:51:12.142Z] \x1b[32m INFO\x1b[0m: \x1b[36mhi\x1b[0m\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer(tc.shouldColorize, "default", "default", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetLinePrefixRegex(tc.prefixRegex); err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.SetLinePrefixRegex("(unclosed"); err == nil {
+		t.Errorf("r.SetLinePrefixRegex() with an invalid regex did not error")
+	}
+}
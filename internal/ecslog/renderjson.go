@@ -0,0 +1,100 @@
+package ecslog
+
+// Support for rendering JSON records that are not ecs-logging records
+// (`--render-json`).
+
+import (
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// Fields, in order of preference, that are used for the title of a non-ECS
+// JSON record. Only string values are used.
+var (
+	nonECSTimestampFields = []string{"@timestamp", "timestamp", "time", "ts", "date", "datetime", "asctime"}
+	nonECSLevelFields     = []string{"log.level", "level", "severity", "lvl", "loglevel", "levelname"}
+	nonECSMessageFields   = []string{"message", "msg", "text"}
+)
+
+// nonECSTitle holds the fields found for the title of a non-ECS JSON record.
+// Each is the lookup path of the field, or nil if not found.
+type nonECSTitle struct {
+	timestamp []string
+	level     []string
+	message   []string
+}
+
+// SetRenderJSON tells the renderer whether to render JSON records that are
+// not ecs-logging records, rather than passing them through. Such records are
+// rendered with a title from the timestamp, level, and message fields that can
+// be found (e.g. "time", "level", and "msg") and are marked as non-ECS.
+func (r *Renderer) SetRenderJSON(renderJSON bool) {
+	r.renderJSON = renderJSON
+}
+
+// findNonECSTitle finds the title fields of a non-ECS JSON record. It sets
+// `r.logLevel` to the found level, if any.
+func (r *Renderer) findNonECSTitle(rec *fastjson.Value) *nonECSTitle {
+	t := &nonECSTitle{
+		timestamp: findStringField(rec, nonECSTimestampFields),
+		level:     findStringField(rec, nonECSLevelFields),
+		message:   findStringField(rec, nonECSMessageFields),
+	}
+	r.logLevel = ""
+	if t.level != nil {
+		r.logLevel = string(jsonutils.LookupValue(rec, t.level...).GetStringBytes())
+	}
+	return t
+}
+
+// findStringField returns the lookup path of the first of the given
+// (dotted) field names that is a string in `rec`, or nil.
+func findStringField(rec *fastjson.Value, names []string) []string {
+	for _, name := range names {
+		lookup := strings.Split(name, ".")
+		if v := jsonutils.LookupValue(rec, lookup...); v != nil && v.Type() == fastjson.TypeString {
+			return lookup
+		}
+	}
+	return nil
+}
+
+// timestampValue returns the value of the found timestamp field, or "".
+func (t *nonECSTitle) timestampValue(rec *fastjson.Value) string {
+	if t.timestamp == nil {
+		return ""
+	}
+	return string(jsonutils.LookupValue(rec, t.timestamp...).GetStringBytes())
+}
+
+// normalize moves the title fields of the record to the ECS fields used by
+// the formatters ("@timestamp", "log.level", and "message"), so that they are
+// rendered in the title rather than as extra fields. An existing
+// "@timestamp" or "message" field that is not used for the title (e.g. a
+// number) is renamed with a leading underscore, so it is still rendered as an
+// extra field.
+func (t *nonECSTitle) normalize(rec *fastjson.Value) {
+	if t.level != nil {
+		jsonutils.ExtractValue(rec, t.level...)
+	}
+	for _, m := range []struct {
+		lookup []string
+		key    string
+	}{
+		{t.timestamp, "@timestamp"},
+		{t.message, "message"},
+	} {
+		if len(m.lookup) == 1 && m.lookup[0] == m.key {
+			continue
+		}
+		if v := rec.Get(m.key); v != nil {
+			rec.Del(m.key)
+			rec.Set("_"+m.key, v)
+		}
+		if m.lookup != nil {
+			rec.Set(m.key, jsonutils.ExtractValue(rec, m.lookup...))
+		}
+	}
+}
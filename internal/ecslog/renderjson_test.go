@@ -0,0 +1,87 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestRenderJSON(t *testing.T) {
+	testCases := []struct {
+		name       string
+		renderJSON bool
+		formatName string
+		kql        string
+		input      string
+		want       string
+	}{
+		{
+			"off by default",
+			false,
+			"default", "",
+			`{"timestamp":"2021-01-19T22:51:12.142Z","severity":"info","msg":"hi"}`,
+			`{"timestamp":"2021-01-19T22:51:12.142Z","severity":"info","msg":"hi"}` + "\n",
+		},
+		{
+			"title fields",
+			true,
+			"default", "",
+			`{"time":"2021-01-19T22:51:12.142Z","severity":"warn","msg":"hi","user":{"id":42}}`,
+			"[2021-01-19T22:51:12.142Z]  WARN [non-ECS]: hi\n    user: {\n        \"id\": 42\n    }\n",
+		},
+		{
+			"no title fields",
+			true,
+			"default", "",
+			`{"a":1}`,
+			"[non-ECS]:\n    a: 1\n",
+		},
+		{
+			"non-string message is kept",
+			true,
+			"default", "",
+			`{"message":{"text":"obj"},"msg":"hi"}`,
+			"[non-ECS]: hi\n    _message: {\n        \"text\": \"obj\"\n    }\n",
+		},
+		{
+			"mixed with ECS and plain lines",
+			true,
+			"simple", "",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"ecs"}
+{"level":"error","msg":"plain json"}
+not json
+[1, 2]`,
+			" INFO: ecs\nERROR [non-ECS]: plain json\nnot json\n[1, 2]\n",
+		},
+		{
+			"kql uses original field names",
+			true,
+			"simple", "level:error or log.level:error",
+			`{"level":"error","msg":"one"}
+{"level":"info","msg":"two"}
+{"log.level":"error","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"three"}`,
+			"ERROR [non-ECS]: one\nERROR: three\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetRenderJSON(tc.renderJSON)
+			if err = r.SetKQLFilter(tc.kql); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package ecslog
+
+// Support for efficiently finding the `--since` and `--until` time range in
+// seekable, time-sorted log files.
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/trentm/go-ecslog/internal/lg"
+)
+
+// minSeekSpan is the size of file region at which the binary search for the
+// start of a time range stops. The rest is scanned linearly.
+const minSeekSpan = 16384
+
+// lineReaderAt returns a reader positioned at the first line start at or after
+// offset `off`, and that line start offset. `start` is the offset at which the
+// input starts, which is always a line start.
+//
+// Because a line split into chunks by a container runtime (see
+// processContainerChunk) cannot be processed from a later chunk, the reader
+// is positioned after any container runtime entries up to and including the
+// first final chunk. In time-sorted input, a skipped line is no later than
+// the line that follows it.
+func (r *Renderer) lineReaderAt(rs io.ReadSeeker, off, start int64) (*bufio.Reader, int64, error) {
+	if off <= start {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		return bufio.NewReaderSize(rs, r.readBufSize()), start, nil
+	}
+
+	// Start at the byte before `off`, in case `off` is itself a line start,
+	// and skip to the end of that line.
+	if _, err := rs.Seek(off-1, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	reader := bufio.NewReaderSize(rs, r.readBufSize())
+	pos := off - 1
+	for {
+		data, err := reader.ReadSlice('\n')
+		pos += int64(len(data))
+		if err == nil {
+			break
+		} else if err == bufio.ErrBufferFull {
+			continue
+		} else if err == io.EOF {
+			return reader, pos, nil
+		} else {
+			return nil, 0, err
+		}
+	}
+
+	for {
+		// Peek at the line, so that it is not consumed if it is not skipped.
+		data, err := reader.Peek(reader.Size())
+		if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+		line := data
+		if idx := bytes.IndexByte(data, '\n'); idx != -1 {
+			line = data[:idx+1]
+		} else if err == nil {
+			break // a line too long to be a chunk
+		}
+		final, ok := r.containerChunk(trimEOL(line))
+		if !ok {
+			break
+		}
+		reader.Discard(len(line))
+		pos += int64(len(line))
+		if final {
+			break
+		}
+	}
+	return reader, pos, nil
+}
+
+// recordTimeAfter returns the time of the first log record whose line starts
+// at or after offset `off` and before offset `limit`.
+func (r *Renderer) recordTimeAfter(rs io.ReadSeeker, off, limit, start int64) (time.Time, bool, error) {
+	reader, pos, err := r.lineReaderAt(rs, off, start)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var wasPrefix bool
+	for pos < limit {
+		line, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return time.Time{}, false, err
+		}
+		// Approximate a line ending of one byte. It doesn't matter if this
+		// position is off by the odd byte for a '\r\n' line ending.
+		pos += int64(len(line))
+		if !isPrefix {
+			pos++
+		}
+		if wasPrefix || isPrefix {
+			wasPrefix = isPrefix
+			continue
+		}
+		it := r.processLine(line)
+		if it.isRecord() {
+			if t, ok := parseTimestamp(it.timestamp); ok {
+				return t, true, nil
+			}
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// lastRecordTime returns the time of the last log record in the input. Only
+// the last part of the input is read.
+func (r *Renderer) lastRecordTime(rs io.ReadSeeker, start, size int64) (time.Time, bool, error) {
+	span := int64(r.readBufSize())
+	for off := size - span; ; off -= span {
+		if off < start {
+			off = start
+		}
+		reader, _, err := r.lineReaderAt(rs, off, start)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		var last time.Time
+		var found, wasPrefix bool
+		for {
+			line, isPrefix, err := reader.ReadLine()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return time.Time{}, false, err
+			}
+			if wasPrefix || isPrefix {
+				wasPrefix = isPrefix
+				continue
+			}
+			it := r.processLine(line)
+			if it.isRecord() {
+				if t, ok := parseTimestamp(it.timestamp); ok {
+					last = t
+					found = true
+				}
+			}
+		}
+		if found || off == start {
+			return last, found, nil
+		}
+	}
+}
+
+// seekToTimeRange positions the input at the line from which to start
+// reading to find all records in the time range filter (see
+// `SetTimeRangeFilter`). This uses a binary search over the input, so that a
+// large log file need not be scanned from the start.
+//
+// This assumes the input is in time order. As a sanity check, if the last
+// record in the input is earlier than the first record, or a record found by
+// the binary search is out of order with those around it, then the input is
+// left at its original position and `sorted` is false.
+func (r *Renderer) seekToTimeRange(rs io.ReadSeeker) (sorted bool, err error) {
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+
+	first, ok, err := r.recordTimeAfter(rs, start, size, start)
+	if err != nil {
+		return false, err
+	}
+	var last time.Time
+	if ok {
+		last, ok, err = r.lastRecordTime(rs, start, size)
+		if err != nil {
+			return false, err
+		}
+	}
+	notSorted := func() (bool, error) {
+		lg.Printf("time range: input is not time-sorted, not seeking\n")
+		_, err := rs.Seek(start, io.SeekStart)
+		return false, err
+	}
+	if !ok || last.Before(first) {
+		return notSorted()
+	}
+
+	// The records at `lo` and `hi` are at times `loTime` and `hiTime`.
+	lo, hi := start, size
+	loTime, hiTime := first, last
+	if !r.since.IsZero() {
+		for hi-lo > minSeekSpan {
+			mid := lo + (hi-lo)/2
+			t, ok, err := r.recordTimeAfter(rs, mid, hi, start)
+			if err != nil {
+				return false, err
+			}
+			if ok && (t.Before(loTime) || t.After(hiTime)) {
+				return notSorted()
+			}
+			if ok && t.Before(r.since) {
+				lo, loTime = mid, t
+			} else {
+				hi = mid
+				if ok {
+					hiTime = t
+				}
+			}
+		}
+	}
+
+	_, pos, err := r.lineReaderAt(rs, lo, start)
+	if err != nil {
+		return false, err
+	}
+	lg.Printf("time range: start reading at offset %d of %d\n", pos, size)
+	_, err = rs.Seek(pos, io.SeekStart)
+	return true, err
+}
+
+// resetTimeRange resets the time range state at the start of an input. Lines
+// before the first record are dropped if there is a `since` bound.
+func (r *Renderer) resetTimeRange() {
+	r.outOfTimeRange = !r.since.IsZero()
+}
+
+// timeRangeItem drops the given item if it is a non-record line that follows
+// a record that is outside the time range (see `SetTimeRangeFilter`). This is
+// independent of where reading starts and stops in time-sorted input, so
+// seeking to the time range gives the same output as reading all the input.
+func (r *Renderer) timeRangeItem(it *renderItem) {
+	if it.isRecord() {
+		r.outOfTimeRange = !r.inTimeRange(it.timestamp)
+	} else if it.kind == itemPassthrough && r.outOfTimeRange {
+		*it = renderItem{kind: itemNone, tsIdx: -1}
+	}
+}
+
+// pastTimeRange returns true iff the given "@timestamp" value is after the
+// end of the time range filter.
+func (r *Renderer) pastTimeRange(timestamp string) bool {
+	if r.until.IsZero() {
+		return false
+	}
+	t, ok := parseTimestamp(timestamp)
+	return ok && t.After(r.until)
+}
@@ -0,0 +1,253 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2021, 1, 19, 22, 51, 12, 0, time.UTC)
+	testCases := []struct {
+		s    string
+		want time.Time
+	}{
+		{"now", now},
+		{"2021-01-19T14:02:00Z", time.Date(2021, 1, 19, 14, 2, 0, 0, time.UTC)},
+		{"2021-01-19T14:02:00.123+01:00", time.Date(2021, 1, 19, 13, 2, 0, 123000000, time.UTC)},
+		{"2021-01-18", time.Date(2021, 1, 18, 0, 0, 0, 0, time.UTC)},
+		{"2021-01-18T09:30", time.Date(2021, 1, 18, 9, 30, 0, 0, time.UTC)},
+		{"14:02", time.Date(2021, 1, 19, 14, 2, 0, 0, time.UTC)},
+		{"14:02:30", time.Date(2021, 1, 19, 14, 2, 30, 0, time.UTC)},
+		{"15m", now.Add(-15 * time.Minute)},
+		{"2h", now.Add(-2 * time.Hour)},
+		{"1h30m", now.Add(-90 * time.Minute)},
+		{"3d", now.Add(-72 * time.Hour)},
+		{"1w", now.Add(-7 * 24 * time.Hour)},
+	}
+	for _, tc := range testCases {
+		got, err := ecslog.ParseTimeBound(tc.s, now)
+		if err != nil {
+			t.Errorf("ParseTimeBound(%q) error: %s", tc.s, err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("ParseTimeBound(%q): want %s, got %s", tc.s, tc.want, got)
+		}
+	}
+
+	for _, s := range []string{"", "bogus", "15x", "-d", "2021-13-01"} {
+		if _, err := ecslog.ParseTimeBound(s, now); err == nil {
+			t.Errorf("ParseTimeBound(%q) did not error", s)
+		}
+	}
+}
+
+// countingReadSeeker counts the bytes read from an io.ReadSeeker.
+type countingReadSeeker struct {
+	io.ReadSeeker
+	n int
+}
+
+func (c *countingReadSeeker) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	c.n += n
+	return n, err
+}
+
+// timeSortedLog returns a log with one record per second for `n` seconds.
+func timeSortedLog(start time.Time, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `{"log.level":"info","@timestamp":"%s","ecs":{"version":"1.5.0"},"message":"record %d"}`+"\n",
+			start.Add(time.Duration(i)*time.Second).Format("2006-01-02T15:04:05.000Z07:00"), i)
+		if i%100 == 0 {
+			b.WriteString("a non-ecs line\n")
+		}
+	}
+	return b.String()
+}
+
+// containerSplitLog returns a time-sorted log of `n` records in the log
+// format of the given container runtime, "docker" or "cri", with each record
+// split into three chunks.
+func containerSplitLog(runtime string, start time.Time, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		ts := start.Add(time.Duration(i) * time.Second).Format("2006-01-02T15:04:05.000Z07:00")
+		if runtime == "cri" {
+			fmt.Fprintf(&b, `%s stdout P {"log.level":"info","@timestamp":"%s",`+"\n", ts, ts)
+			fmt.Fprintf(&b, `%s stdout P "ecs":{"version":"1.5.0"},`+"\n", ts)
+			fmt.Fprintf(&b, `%s stdout F "message":"record %d"}`+"\n", ts, i)
+			continue
+		}
+		fmt.Fprintf(&b, `{"log":"{\"log.level\":\"info\",\"@timestamp\":\"%s\",","stream":"stdout","time":"%s"}`+"\n", ts, ts)
+		fmt.Fprintf(&b, `{"log":"\"ecs\":{\"version\":\"1.5.0\"},","stream":"stdout","time":"%s"}`+"\n", ts)
+		fmt.Fprintf(&b, `{"log":"\"message\":\"record %d\"}\n","stream":"stdout","time":"%s"}`+"\n", i, ts)
+	}
+	return b.String()
+}
+
+func TestTimeRangeFilter(t *testing.T) {
+	start := time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC)
+	log := timeSortedLog(start, 100000)
+	since := start.Add(50000 * time.Second)
+	until := start.Add(50002 * time.Second)
+	want := "[2021-01-19T13:53:20.000Z]  INFO: record 50000\n" +
+		"[2021-01-19T13:53:21.000Z]  INFO: record 50001\n" +
+		"[2021-01-19T13:53:22.000Z]  INFO: record 50002\n"
+
+	newRenderer := func() *ecslog.Renderer {
+		r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetStrictFilter(true)
+		r.SetTimeRangeFilter(since, until)
+		return r
+	}
+
+	// A seekable input is binary searched, so most of it is not read.
+	in := &countingReadSeeker{ReadSeeker: strings.NewReader(log)}
+	var out bytes.Buffer
+	if err := newRenderer().RenderFile(in, &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+	if in.n > len(log)/10 {
+		t.Errorf("r.RenderFile() read %d bytes of %d byte seekable input, expected a binary search", in.n, len(log))
+	}
+
+	// A non-seekable input is filtered by scanning.
+	out.Reset()
+	if err := newRenderer().RenderFile(bytes.NewBufferString(log), &out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTimeRangeFilterMixedTimeZones(t *testing.T) {
+	// String comparison of these timestamps would get this wrong.
+	log := `{"log.level":"info","@timestamp":"2021-01-19T23:50:00+01:00","ecs":{"version":"1.5.0"},"message":"before"}
+{"log.level":"info","@timestamp":"2021-01-19T22:51:00Z","ecs":{"version":"1.5.0"},"message":"during"}
+{"log.level":"info","ecs":{"version":"1.5.0"},"message":"no timestamp"}
+{"log.level":"info","@timestamp":"2021-01-19T14:52:00.5-08:00","ecs":{"version":"1.5.0"},"message":"after"}
+`
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTimeRangeFilter(
+		time.Date(2021, 1, 19, 22, 51, 0, 0, time.UTC),
+		time.Date(2021, 1, 19, 22, 52, 0, 0, time.UTC))
+	var out bytes.Buffer
+	if err = r.RenderFile(bytes.NewBufferString(log), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := " INFO: during\n" +
+		`{"log.level":"info","ecs":{"version":"1.5.0"},"message":"no timestamp"}` + "\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTimeRangeFilterNonRecordLines(t *testing.T) {
+	// Non-record lines have the time of the preceding record, so reading a
+	// seekable input from where the binary search starts gives the same
+	// output as scanning all of it.
+	start := time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&b, "plain line %d\n", i)
+		fmt.Fprintf(&b, `{"log.level":"info","@timestamp":"%s","ecs":{"version":"1.5.0"},"message":"record %d"}`+"\n",
+			start.Add(time.Duration(i)*time.Second).Format(time.RFC3339), i)
+	}
+	log := b.String()
+	testCases := []struct {
+		since, until int // in seconds after `start`, or -1 for no bound
+		want         string
+	}{
+		{10000, 10001, " INFO: record 10000\nplain line 10001\n INFO: record 10001\nplain line 10002\n"},
+		{19998, -1, " INFO: record 19998\nplain line 19999\n INFO: record 19999\n"},
+		{-1, 1, "plain line 0\n INFO: record 0\nplain line 1\n INFO: record 1\nplain line 2\n"},
+	}
+	for _, tc := range testCases {
+		var since, until time.Time
+		if tc.since != -1 {
+			since = start.Add(time.Duration(tc.since) * time.Second)
+		}
+		if tc.until != -1 {
+			until = start.Add(time.Duration(tc.until) * time.Second)
+		}
+		for _, in := range []io.Reader{strings.NewReader(log), bytes.NewBufferString(log)} {
+			r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetTimeRangeFilter(since, until)
+			var out bytes.Buffer
+			if err := r.RenderFile(in, &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("since %d, until %d, %T input: r.RenderFile() mismatch (-want +got):\n%s", tc.since, tc.until, in, diff)
+			}
+		}
+	}
+}
+
+func TestTimeRangeFilterUnsorted(t *testing.T) {
+	// The first and last records are in order, but the middle of the input
+	// is earlier than both. The binary search notices, and falls back to
+	// scanning all the input.
+	start := time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC)
+	log := timeSortedLog(start.Add(10000*time.Second), 10000) +
+		timeSortedLog(start, 10000) +
+		timeSortedLog(start.Add(20000*time.Second), 10000)
+	r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetStrictFilter(true)
+	r.SetTimeRangeFilter(start.Add(10005*time.Second), start.Add(10006*time.Second))
+	var out bytes.Buffer
+	if err := r.RenderFile(strings.NewReader(log), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := " INFO: record 5\n INFO: record 6\n"
+	if diff := cmp.Diff(want, out.String()); diff != "" {
+		t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTimeRangeFilterSplitLines(t *testing.T) {
+	// The binary search must not start reading in the middle of a line split
+	// into chunks by a container runtime.
+	start := time.Date(2021, 1, 19, 0, 0, 0, 0, time.UTC)
+	for _, runtime := range []string{"docker", "cri"} {
+		log := containerSplitLog(runtime, start, 20000)
+		for _, since := range []int{10000, 10001, 10002, 15000, 17777} {
+			r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetTimeRangeFilter(start.Add(time.Duration(since)*time.Second), start.Add(time.Duration(since+1)*time.Second))
+			var out bytes.Buffer
+			if err := r.RenderFile(strings.NewReader(log), &out); err != nil {
+				t.Fatal(err)
+			}
+			want := fmt.Sprintf(" INFO: record %d\n INFO: record %d\n", since, since+1)
+			if diff := cmp.Diff(want, out.String()); diff != "" {
+				t.Errorf("%s, since record %d: r.RenderFile() mismatch (-want +got):\n%s", runtime, since, diff)
+			}
+		}
+	}
+}
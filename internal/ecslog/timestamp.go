@@ -0,0 +1,123 @@
+package ecslog
+
+// Parsing of "@timestamp" values, for comparing records by time, and of times
+// given on the command line.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the layouts tried, in order, when parsing a
+// "@timestamp" value. ECS specifies ISO 8601, but in practice that is almost
+// always RFC 3339 with some variations.
+var timestampLayouts = []string{
+	time.RFC3339Nano,                     // 2021-01-19T22:51:12.142Z
+	"2006-01-02T15:04:05.999999999Z0700", // 2021-01-19T22:51:12.142+0000
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z0700",
+}
+
+// timestampLocalLayouts are layouts without a time zone. These are parsed as
+// local time.
+var timestampLocalLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// parseTimestamp parses a "@timestamp" value. It returns false if the value
+// is not in a recognized format.
+func parseTimestamp(s string) (time.Time, bool) {
+	// Some loggers (e.g. log4j) use a comma for fractional seconds, which Go
+	// versions before 1.17 do not parse.
+	if len(s) > 20 && s[19] == ',' {
+		s = s[:19] + "." + s[20:]
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range timestampLocalLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// timeBoundLayouts are the absolute time layouts accepted by ParseTimeBound,
+// in addition to those for "@timestamp" values. These are parsed as local
+// time.
+var timeBoundLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// timeOfDayLayouts are time-of-day layouts accepted by ParseTimeBound. These
+// are interpreted as that time today, local time.
+var timeOfDayLayouts = []string{
+	"15:04:05.999999999",
+	"15:04",
+}
+
+// ParseTimeBound parses a time given for the `--since` or `--until` options.
+// It accepts:
+// - an RFC 3339 time, e.g. "2021-01-19T22:51:12Z" (a time without a time zone
+//   offset is interpreted as local time);
+// - a date, e.g. "2021-01-19", meaning midnight local time;
+// - a time of day, e.g. "14:02", meaning that time today, local time; or
+// - a relative duration before `now`, e.g. "15m", "2h", "1h30m", or "3d".
+func ParseTimeBound(s string, now time.Time) (time.Time, error) {
+	if s == "now" {
+		return now, nil
+	}
+	if t, ok := parseTimestamp(s); ok {
+		return t, nil
+	}
+	for _, layout := range timeBoundLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range timeOfDayLayouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			y, m, d := now.Date()
+			return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(),
+				t.Nanosecond(), now.Location()), nil
+		}
+	}
+	if d, err := parseRelativeDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: expected an RFC 3339 time, "+
+		"a date, a time of day, or a duration such as '15m' or '2h'", s)
+}
+
+// parseRelativeDuration parses a Go duration string (e.g. "1h30m"), with
+// additional support for day ("d") and week ("w") units.
+func parseRelativeDuration(s string) (time.Duration, error) {
+	s = strings.TrimPrefix(s, "-")
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		count, err := strconv.Atoi(s[:n-1])
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit := 24 * time.Hour
+		if s[n-1] == 'w' {
+			unit *= 7
+		}
+		return time.Duration(count) * unit, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,442 @@
+package ecslog
+
+// Support for the title line template of the "default" and "compact" formats
+// (`-t, --title TEMPLATE`).
+//
+// A title template is text with these special forms:
+//
+//    ${FIELD}         the value of the (dotted) field FIELD
+//    ${FIELD:ROLE}    the value of FIELD, painted with painter role ROLE
+//    $[...]           a group, rendered only if a field in it has a value
+//    $ROLE[...]       a group that is painted with painter role ROLE
+//    $|SEP|           a separator, rendered only if there is a field with a
+//                     value both before and after it in the same group
+//    $$, $]           a literal "$" or "]"
+//
+// Fields used in the title are removed from the record, so they are not
+// rendered again as extra fields. Some fields are special: "@timestamp" is
+// rendered in square brackets (see `styleTimestamp`), "log.level" is rendered
+// upper case and painted with a role for the level, and "@nonECS" is a
+// "[non-ECS]" marker for records rendered with `--render-json`.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// DefaultTitleTemplate is the title line template used by default:
+//
+//    [@timestamp] LOG.LEVEL (log.logger/service.name on host.hostname): message
+const DefaultTitleTemplate = "$[$[${@timestamp} ]${log.level}" +
+	"$[ ($[${log.logger}$|/|${service.name}]$| |$[on ${host.hostname}])]" +
+	"$| |${@nonECS}:]$| |${message}"
+
+var defaultTitleTemplate = func() *titleTemplate {
+	t := mustParseTitleTemplate(DefaultTitleTemplate)
+	t.stringsOnly = true
+	return t
+}()
+
+type titleNodeKind int
+
+const (
+	titleText titleNodeKind = iota
+	titleField
+	titleSep
+	titleGroup
+)
+
+// titleNode is a part of a parsed title template.
+type titleNode struct {
+	kind     titleNodeKind
+	text     string      // the text of a titleText or titleSep
+	field    int         // the index in `titleTemplate.fields` of a titleField
+	role     string      // the painter role of a titleField or titleGroup, if any
+	children []titleNode // the contents of a titleGroup
+}
+
+// titleTemplate is a parsed title template.
+type titleTemplate struct {
+	nodes  []titleNode
+	fields []string // the fields used in the template, each once
+	// stringsOnly is true for the default template, which renders records as
+	// before there were title templates: fields only take string values, and
+	// a non-string "message" is dropped.
+	stringsOnly bool
+}
+
+// titleValue is the value of a field used in a title template for a record.
+type titleValue struct {
+	ok   bool
+	text []byte
+}
+
+// SetTitleTemplate sets the template for the title line of each rendered log
+// record in the "default" and "compact" formats. An empty template means
+// `DefaultTitleTemplate`.
+func (r *Renderer) SetTitleTemplate(s string) error {
+	if s == "" {
+		r.titleTemplate = defaultTitleTemplate
+		return nil
+	}
+	t, err := parseTitleTemplate(s)
+	if err != nil {
+		return err
+	}
+	r.titleTemplate = t
+	return nil
+}
+
+// parseTitleTemplate parses the given title template.
+func parseTitleTemplate(s string) (*titleTemplate, error) {
+	p := titleParser{s: s, t: &titleTemplate{}}
+	nodes, err := p.parseNodes(-1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %s", err)
+	}
+	p.t.nodes = nodes
+	return p.t, nil
+}
+
+func mustParseTitleTemplate(s string) *titleTemplate {
+	t, err := parseTitleTemplate(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+type titleParser struct {
+	s   string
+	pos int
+	t   *titleTemplate
+}
+
+// parseNodes parses template nodes up to the end of the template or, for a
+// group starting at `groupStart`, up to the "]" that ends the group.
+func (p *titleParser) parseNodes(groupStart int) ([]titleNode, error) {
+	inGroup := groupStart != -1
+	var nodes []titleNode
+	var text strings.Builder
+	addText := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, titleNode{kind: titleText, text: text.String()})
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == ']' && inGroup {
+			p.pos++
+			addText()
+			return nodes, nil
+		}
+		if c != '$' {
+			text.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.s) {
+			return nil, fmt.Errorf("unexpected end after '$' at position %d", p.pos)
+		}
+		switch next := p.s[p.pos+1]; {
+		case next == '$' || next == ']':
+			text.WriteByte(next)
+			p.pos += 2
+		case next == '{':
+			addText()
+			node, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case next == '|':
+			addText()
+			end := strings.IndexByte(p.s[p.pos+2:], '|')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated separator at position %d", p.pos)
+			}
+			nodes = append(nodes, titleNode{kind: titleSep, text: p.s[p.pos+2 : p.pos+2+end]})
+			p.pos += 2 + end + 1
+		case next == '[' || isRoleChar(next):
+			addText()
+			groupStart := p.pos
+			p.pos++
+			roleStart := p.pos
+			for p.pos < len(p.s) && isRoleChar(p.s[p.pos]) {
+				p.pos++
+			}
+			role := p.s[roleStart:p.pos]
+			if p.pos >= len(p.s) || p.s[p.pos] != '[' {
+				return nil, fmt.Errorf("expected '[' after '$%s' at position %d", role, groupStart)
+			}
+			p.pos++
+			children, err := p.parseNodes(groupStart)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, titleNode{kind: titleGroup, role: role, children: children})
+		default:
+			return nil, fmt.Errorf("unexpected '%c' after '$' at position %d", next, p.pos)
+		}
+	}
+	if inGroup {
+		return nil, fmt.Errorf("unterminated group at position %d", groupStart)
+	}
+	addText()
+	return nodes, nil
+}
+
+// parseField parses a "${FIELD}" or "${FIELD:ROLE}" field reference.
+func (p *titleParser) parseField() (titleNode, error) {
+	end := strings.IndexByte(p.s[p.pos:], '}')
+	if end == -1 {
+		return titleNode{}, fmt.Errorf("unterminated field reference at position %d", p.pos)
+	}
+	ref := p.s[p.pos+2 : p.pos+end]
+	name, role := ref, ""
+	if i := strings.IndexByte(ref, ':'); i != -1 {
+		name, role = ref[:i], ref[i+1:]
+	}
+	if name == "" {
+		return titleNode{}, fmt.Errorf("empty field name at position %d", p.pos)
+	}
+	p.pos += end + 1
+
+	idx := -1
+	for i, f := range p.t.fields {
+		if f == name {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		idx = len(p.t.fields)
+		p.t.fields = append(p.t.fields, name)
+	}
+	return titleNode{kind: titleField, field: idx, role: role}, nil
+}
+
+func isRoleChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// extractValues extracts the values of the fields used in the template from
+// the record. Only scalar values are used (only strings for the default
+// template): other values are left in the record, to be rendered as extra
+// fields.
+func (t *titleTemplate) extractValues(r *Renderer, rec *fastjson.Value) []titleValue {
+	vals := make([]titleValue, len(t.fields))
+	for i, name := range t.fields {
+		switch name {
+		case "@timestamp":
+			if v := jsonutils.ExtractValue(rec, "@timestamp"); v != nil && v.Type() == fastjson.TypeString {
+				vals[i] = titleValue{true, v.GetStringBytes()}
+			}
+		case "log.level":
+			// This has already been read, see `isECSLoggingRecord`.
+			jsonutils.ExtractValue(rec, "log", "level")
+			if r.logLevel != "" {
+				vals[i] = titleValue{true, []byte(r.logLevel)}
+			}
+		case "@nonECS":
+			if r.nonECS {
+				vals[i] = titleValue{true, []byte("[non-ECS]")}
+			}
+		default:
+			lookup := strings.Split(name, ".")
+			if t.stringsOnly {
+				var v *fastjson.Value
+				if name == "message" {
+					v = jsonutils.ExtractValue(rec, lookup...)
+				} else {
+					v = jsonutils.ExtractValueOfType(rec, fastjson.TypeString, lookup...)
+				}
+				if v != nil && v.Type() == fastjson.TypeString {
+					vals[i] = titleValue{true, v.GetStringBytes()}
+				}
+				continue
+			}
+			v := jsonutils.LookupValue(rec, lookup...)
+			if v == nil {
+				continue
+			}
+			switch v.Type() {
+			case fastjson.TypeString:
+				vals[i] = titleValue{true, v.GetStringBytes()}
+			case fastjson.TypeNumber, fastjson.TypeTrue, fastjson.TypeFalse:
+				vals[i] = titleValue{true, []byte(v.String())}
+			default:
+				continue
+			}
+			jsonutils.ExtractValue(rec, lookup...)
+		}
+	}
+	return vals
+}
+
+// titleWriter writes a title line for a record.
+type titleWriter struct {
+	r       *Renderer
+	t       *titleTemplate
+	vals    []titleValue
+	b       *strings.Builder
+	roles   []string // the stack of painter roles in effect
+	painted string   // the painter role that was last painted, if any
+}
+
+// formatTitleLine writes the title line for the record, using the title
+// template set with `SetTitleTemplate`.
+func formatTitleLine(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
+	t := r.titleTemplate
+	w := titleWriter{r: r, t: t, vals: t.extractValues(r, rec), b: b}
+	w.writeNodes(t.nodes)
+	w.sync()
+}
+
+// hasValue returns true iff the given node is a field with a value, or a
+// group that is rendered.
+func (w *titleWriter) hasValue(n *titleNode) bool {
+	switch n.kind {
+	case titleField:
+		return w.vals[n.field].ok
+	case titleGroup:
+		return w.groupIsRendered(n)
+	}
+	return false
+}
+
+// groupIsRendered returns true iff a field in the group has a value, or the
+// group has no fields.
+func (w *titleWriter) groupIsRendered(n *titleNode) bool {
+	return w.groupHasValue(n) || !groupHasFields(n)
+}
+
+// groupHasValue returns true iff a field in the group, or in a nested group,
+// has a value.
+func (w *titleWriter) groupHasValue(n *titleNode) bool {
+	for i := range n.children {
+		c := &n.children[i]
+		if (c.kind == titleField && w.vals[c.field].ok) ||
+			(c.kind == titleGroup && w.groupHasValue(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+func groupHasFields(n *titleNode) bool {
+	for i := range n.children {
+		c := &n.children[i]
+		if c.kind == titleField || (c.kind == titleGroup && groupHasFields(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *titleWriter) writeNodes(nodes []titleNode) {
+	before := false // true if a field or group with a value has been written
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.kind {
+		case titleText:
+			w.sync()
+			w.b.WriteString(n.text)
+		case titleSep:
+			if !before {
+				continue
+			}
+			for j := i + 1; j < len(nodes); j++ {
+				if w.hasValue(&nodes[j]) {
+					w.sync()
+					w.b.WriteString(n.text)
+					break
+				}
+			}
+		case titleField:
+			if w.vals[n.field].ok {
+				w.writeField(n)
+				before = true
+			}
+		case titleGroup:
+			if w.groupIsRendered(n) {
+				w.push(n.role)
+				w.writeNodes(n.children)
+				w.pop(n.role)
+				before = true
+			}
+		}
+	}
+}
+
+func (w *titleWriter) writeField(n *titleNode) {
+	val := w.vals[n.field].text
+	name := w.t.fields[n.field]
+	if name == "@timestamp" {
+		// The timestamp is styled when the record is written, which resets
+		// any painting.
+		w.sync()
+		w.r.tsIdx = w.b.Len()
+		w.b.WriteByte('[')
+		w.b.Write(val)
+		w.b.WriteByte(']')
+		w.r.tsEnd = w.b.Len()
+		w.painted = ""
+		return
+	}
+
+	role := n.role
+	if role == "" {
+		switch name {
+		case "log.level":
+			role = strings.ToLower(string(val))
+		case "@nonECS":
+			role = "nonECS"
+		case "message":
+			role = "message"
+		}
+	}
+	w.push(role)
+	w.sync()
+	if name == "log.level" {
+		fmt.Fprintf(w.b, "%5s", strings.ToUpper(string(val)))
+	} else {
+		w.b.Write(val)
+	}
+	w.pop(role)
+}
+
+// push starts using the given painter role, if any, for following text. Roles
+// do not combine: the innermost role is used.
+func (w *titleWriter) push(role string) {
+	if role != "" {
+		w.roles = append(w.roles, role)
+	}
+}
+
+// pop stops using the given painter role, if any.
+func (w *titleWriter) pop(role string) {
+	if role != "" {
+		w.roles = w.roles[:len(w.roles)-1]
+	}
+}
+
+// sync paints with the painter role in effect, if it is not already painted.
+func (w *titleWriter) sync() {
+	role := ""
+	if len(w.roles) > 0 {
+		role = w.roles[len(w.roles)-1]
+	}
+	if role == w.painted {
+		return
+	}
+	w.r.painter.Reset(w.b)
+	if role != "" {
+		w.r.painter.Paint(w.b, role)
+	}
+	w.painted = role
+}
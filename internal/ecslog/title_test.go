@@ -0,0 +1,137 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestTitleTemplate(t *testing.T) {
+	rec := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","service":{"name":"api"},"process":{"pid":200},"labels":{"a":1}}`
+	testCases := []struct {
+		name       string
+		formatName string
+		colorize   string
+		template   string
+		input      string
+		want       string
+	}{
+		{
+			"default template",
+			"default", "no", "", rec,
+			"[2021-01-19T22:51:12.142Z]  INFO (api): hi\n" +
+				"    process: {\n        \"pid\": 200\n    }\n" +
+				"    labels: {\n        \"a\": 1\n    }\n",
+		},
+		{
+			"default template only uses strings",
+			"compact", "no", "",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","log.logger":true,"service":{"name":7},"host":{"hostname":"h"}}`,
+			"[2021-01-19T22:51:12.142Z]  INFO (on h): hi\n" +
+				"    log.logger: true\n" +
+				"    service: {\"name\": 7}\n",
+		},
+		{
+			"templates use numbers and booleans",
+			"compact", "no", ecslog.DefaultTitleTemplate,
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","log.logger":true,"service":{"name":7},"host":{"hostname":"h"}}`,
+			"[2021-01-19T22:51:12.142Z]  INFO (true/7 on h): hi\n",
+		},
+		{
+			"fields used in the title are not extra fields",
+			"compact", "no", "${log.level} ${process.pid} ${message}", rec,
+			" INFO 200 hi\n" +
+				"    @timestamp: \"2021-01-19T22:51:12.142Z\"\n" +
+				"    service: {\"name\": \"api\"}\n" +
+				"    labels: {\"a\": 1}\n",
+		},
+		{
+			"non-scalar fields are not used",
+			"compact", "no", "$[(${labels})]${message}", rec,
+			"hi\n" +
+				"    log.level: \"info\"\n" +
+				"    @timestamp: \"2021-01-19T22:51:12.142Z\"\n" +
+				"    service: {\"name\": \"api\"}\n" +
+				"    process: {\"pid\": 200}\n" +
+				"    labels: {\"a\": 1}\n",
+		},
+		{
+			"group with a missing field",
+			"compact", "no", "$[${service.name}$|/|${log.logger}: ]$[<${url.path}> ]${message}", rec,
+			"api: hi\n" +
+				"    log.level: \"info\"\n" +
+				"    @timestamp: \"2021-01-19T22:51:12.142Z\"\n" +
+				"    process: {\"pid\": 200}\n" +
+				"    labels: {\"a\": 1}\n",
+		},
+		{
+			"separators",
+			"compact", "no", "$|-|${log.logger}$| |${message}$| |${url.path}", rec,
+			"hi\n" +
+				"    log.level: \"info\"\n" +
+				"    @timestamp: \"2021-01-19T22:51:12.142Z\"\n" +
+				"    service: {\"name\": \"api\"}\n" +
+				"    process: {\"pid\": 200}\n" +
+				"    labels: {\"a\": 1}\n",
+		},
+		{
+			"escapes",
+			"compact", "no", "$[[${service.name}$]] $$${message}", rec,
+			"[api] $hi\n" +
+				"    log.level: \"info\"\n" +
+				"    @timestamp: \"2021-01-19T22:51:12.142Z\"\n" +
+				"    process: {\"pid\": 200}\n" +
+				"    labels: {\"a\": 1}\n",
+		},
+		{
+			"painter roles",
+			"compact", "yes", "$extraField[<${service.name}> ${message:jsonString}] ${log.level}",
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","service":{"name":"api"}}`,
+			"\x1b[1m<api> \x1b[0m\x1b[32mhi\x1b[0m \x1b[32m INFO\x1b[0m\n" +
+				"    \x1b[1m@timestamp\x1b[0m: \x1b[32m\"2021-01-19T22:51:12.142Z\"\x1b[0m\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer(tc.colorize, "default", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.SetTitleTemplate(tc.template); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTitleTemplateErrors(t *testing.T) {
+	testCases := []struct {
+		template string
+		want     string
+	}{
+		{"${message} $[(${log.logger})", "invalid title template: unterminated group at position 11"},
+		{"${message", "invalid title template: unterminated field reference at position 0"},
+		{"${:message}", "invalid title template: empty field name at position 0"},
+		{"$ ${message}", "invalid title template: unexpected ' ' after '$' at position 0"},
+		{"$message ${message}", "invalid title template: expected '[' after '$message' at position 0"},
+	}
+	for _, tc := range testCases {
+		r, err := ecslog.NewRenderer("no", "", "default", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.SetTitleTemplate(tc.template)
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("r.SetTitleTemplate(%q) error:\ngot:  %v\nwant: %s", tc.template, err, tc.want)
+		}
+	}
+}
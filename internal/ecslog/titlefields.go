@@ -0,0 +1,118 @@
+package ecslog
+
+// Support for rendering selected fields on the title line
+// (`--title-fields FIELDS`).
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// SetTitleFields sets fields to render at the end of the title line of the
+// "default" and "compact" formats, rather than as extra fields. They are
+// rendered in KQL form, e.g. `(trace.id:abc123, url.path:"/a b")`, so each
+// "key:value" can be used with `SetKQLFilter`.
+//
+// Only string, number, and boolean values are rendered on the title line.
+// Other values (null, objects, and arrays) are rendered as extra fields.
+func (r *Renderer) SetTitleFields(fields []string) {
+	r.titleFields = nil
+	for _, f := range fields {
+		if f != "" {
+			r.titleFields = append(r.titleFields, f)
+		}
+	}
+}
+
+// formatTitleFields writes the title fields (see `SetTitleFields`) that are
+// in the record, and removes them from the record.
+func formatTitleFields(r *Renderer, rec *fastjson.Value, b *strings.Builder) {
+	n := 0
+	for _, field := range r.titleFields {
+		lookup := strings.Split(field, ".")
+		v := jsonutils.LookupValue(rec, lookup...)
+		if v == nil {
+			continue
+		}
+		var role string
+		switch v.Type() {
+		case fastjson.TypeString:
+			role = "jsonString"
+		case fastjson.TypeNumber:
+			role = "jsonNumber"
+		case fastjson.TypeTrue:
+			role = "jsonTrue"
+		case fastjson.TypeFalse:
+			role = "jsonFalse"
+		default:
+			continue
+		}
+		jsonutils.ExtractValue(rec, lookup...)
+
+		if n == 0 {
+			if b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteByte('(')
+		} else {
+			b.WriteString(", ")
+		}
+		n++
+		r.painter.Paint(b, "extraField")
+		b.WriteString(field)
+		r.painter.Reset(b)
+		b.WriteByte(':')
+		r.painter.Paint(b, role)
+		if role == "jsonString" {
+			b.WriteString(kqlValue(string(v.GetStringBytes())))
+		} else {
+			b.WriteString(v.String())
+		}
+		r.painter.Reset(b)
+	}
+	if n > 0 {
+		b.WriteByte(')')
+	}
+}
+
+// kqlUnquotedSpecials are the characters that cannot be in an unquoted KQL
+// value: whitespace and the KQL special characters, which the kqlog lexer
+// either ends an unquoted literal at or rejects, and the "*" wildcard. A ","
+// is included because it separates the title fields.
+const kqlUnquotedSpecials = " \t\r\n\\():<>\"*{},\x00"
+
+// kqlValue returns the given string as a KQL value: unquoted if possible,
+// otherwise quoted.
+func kqlValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, kqlUnquotedSpecials) {
+		switch strings.ToLower(s) {
+		case "or", "and", "not", "true", "false":
+		default:
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return s
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
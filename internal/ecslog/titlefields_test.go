@@ -0,0 +1,125 @@
+package ecslog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/trentm/go-ecslog/internal/ecslog"
+)
+
+func TestTitleFields(t *testing.T) {
+	testCases := []struct {
+		name        string
+		formatName  string
+		titleFields []string
+		input       string
+		want        string
+	}{
+		{
+			"scalar values",
+			"default",
+			[]string{"trace.id", "http.request.method", "http.response.status_code", "event.success", "missing"},
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","trace":{"id":"abc123"},"http":{"request":{"method":"GET"},"response":{"status_code":200}},"event.success":true}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi (trace.id:abc123, http.request.method:GET, http.response.status_code:200, event.success:true)\n",
+		},
+		{
+			"quoted values",
+			"default",
+			[]string{"url.path", "a", "b", "c", "d", "e"},
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","url.path":"/a b","a":"","b":"say \"hi\"\n","c":"200","d":"OR","e":"x*"}`,
+			`[2021-01-19T22:51:12.142Z]  INFO: hi (url.path:"/a b", a:"", b:"say \"hi\"\n", c:"200", d:"OR", e:"x*")` + "\n",
+		},
+		{
+			"non-scalar values are extra fields",
+			"compact",
+			[]string{"tags", "labels", "error", "trace.id"},
+			`{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi","tags":["a"],"labels":{"a":"b"},"error":null,"trace.id":"abc"}`,
+			"[2021-01-19T22:51:12.142Z]  INFO: hi (trace.id:abc)\n" +
+				"    tags: [\"a\"]\n" +
+				"    labels: {\"a\": \"b\"}\n" +
+				"    error: null\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := ecslog.NewRenderer("no", "", tc.formatName, -1, []string{}, []string{}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetTitleFields(tc.titleFields)
+			var out bytes.Buffer
+			if err = r.RenderFile(bytes.NewBufferString(tc.input+"\n"), &out); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("r.RenderFile() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// Each "key:value" rendered in the title fields is usable as a KQL filter.
+func TestTitleFieldsKQL(t *testing.T) {
+	rec := `{"log.level":"info","@timestamp":"2021-01-19T22:51:12.142Z","ecs.version":"1.6.0","message":"hi",` +
+		`"a":"say \"hi\" (now)\tok","b":"200","c":200,"d":"x,","e":"a,b","f":"nul\u0000","g":"{}","h":"not","i":"x*y","j":"c:\\dir"}`
+	fields := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	r, err := ecslog.NewRenderer("no", "", "compact", -1, []string{}, []string{}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetTitleFields(fields)
+	var out bytes.Buffer
+	if err = r.RenderFile(bytes.NewBufferString(rec+"\n"), &out); err != nil {
+		t.Fatal(err)
+	}
+	title := strings.TrimSuffix(out.String(), "\n")
+	const prefix = "[2021-01-19T22:51:12.142Z]  INFO: hi ("
+	if !strings.HasPrefix(title, prefix) || !strings.HasSuffix(title, ")") {
+		t.Fatalf("unexpected title line: %q", title)
+	}
+
+	kqls := splitTitleFields(title[len(prefix) : len(title)-1])
+	if len(kqls) != len(fields) {
+		t.Fatalf("title fields %q split into %d parts, want %d: %q", title, len(kqls), len(fields), kqls)
+	}
+	for _, kql := range kqls {
+		r, err := ecslog.NewRenderer("no", "", "simple", -1, []string{}, []string{}, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.SetKQLFilter(kql); err != nil {
+			t.Errorf("title field %q is not valid KQL: %s", kql, err)
+			continue
+		}
+		var out bytes.Buffer
+		if err = r.RenderFile(bytes.NewBufferString(rec+"\n"), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.Len() == 0 {
+			t.Errorf("title field %q did not match the record", kql)
+		}
+	}
+}
+
+// splitTitleFields splits the rendered title fields, e.g.
+// `a:b, c:"d, e"`, at each "," outside of quoted values.
+func splitTitleFields(s string) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == ',' && !inQuotes:
+			parts = append(parts, strings.TrimPrefix(s[start:i], " "))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimPrefix(s[start:], " "))
+}
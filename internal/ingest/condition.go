@@ -0,0 +1,657 @@
+package ingest
+
+// Support for processor "if" conditions: a small subset of Painless, e.g.:
+//     ctx.log?.level == 'error' && !ctx.message.contains('healthcheck')
+//
+// Supported:
+// - `ctx` field access: `ctx.a.b`, null-safe `ctx?.a?.b`, and `ctx['a.b']`.
+//   As elsewhere in ecslog, `ctx.log.level` also finds a "log.level" field.
+// - string, number, boolean, and null literals
+// - operators: `||`, `&&`, `!`, `==`, `!=`, `<`, `<=`, `>`, `>=`, and
+//   parentheses
+// - methods: contains, containsKey, endsWith, equals, equalsIgnoreCase,
+//   isEmpty, length, size, startsWith, toLowerCase, toUpperCase, trim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// condition is a parsed "if" condition.
+type condition struct {
+	src  string
+	expr condExpr
+}
+
+// condExpr is a node in a parsed condition. Values are nil, bool, float64,
+// string, or a *fastjson.Value for objects and arrays.
+type condExpr interface {
+	eval(d *document) (interface{}, error)
+}
+
+// parseCondition parses a condition from its Painless source.
+func parseCondition(src string) (*condition, error) {
+	toks, err := lexCondition(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &condParser{toks: toks}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.typ != condTokEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+	}
+	return &condition{src: src, expr: expr}, nil
+}
+
+// eval evaluates the condition on a document. The condition must evaluate to
+// a boolean.
+func (c *condition) eval(d *document) (bool, error) {
+	v, err := c.expr.eval(d)
+	if err != nil {
+		return false, fmt.Errorf("error evaluating condition [%s]: %s", c.src, err)
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition [%s] did not evaluate to a boolean (got %s)", c.src, condTypeName(v))
+	}
+	return b, nil
+}
+
+// ---- Lexing
+
+type condTokType int
+
+const (
+	condTokEOF condTokType = iota
+	condTokIdent
+	condTokString
+	condTokNumber
+	condTokOp // operators and punctuation
+)
+
+type condTok struct {
+	typ  condTokType
+	text string // for condTokString, this is the unquoted value
+	pos  int
+}
+
+// condOps are the supported operators and punctuation, longest first.
+var condOps = []string{"||", "&&", "==", "!=", "<=", ">=", "?.", "!", "<", ">", "(", ")", "[", "]", ".", ","}
+
+func lexCondition(src string) ([]condTok, error) {
+	var toks []condTok
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				b.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			toks = append(toks, condTok{condTokString, b.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, condTok{condTokNumber, src[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, condTok{condTokIdent, src[i:j], i})
+			i = j
+		default:
+			found := false
+			for _, op := range condOps {
+				if strings.HasPrefix(src[i:], op) {
+					toks = append(toks, condTok{condTokOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+	toks = append(toks, condTok{condTokEOF, "end of condition", len(src)})
+	return toks, nil
+}
+
+// ---- Parsing
+
+type condParser struct {
+	toks []condTok
+	i    int
+}
+
+func (p *condParser) peek() condTok {
+	return p.toks[p.i]
+}
+
+func (p *condParser) next() condTok {
+	tok := p.toks[p.i]
+	if tok.typ != condTokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// acceptOp consumes the next token if it is the given operator.
+func (p *condParser) acceptOp(op string) bool {
+	if tok := p.peek(); tok.typ == condTokOp && tok.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *condParser) expectOp(op string) error {
+	if !p.acceptOp(op) {
+		tok := p.peek()
+		return fmt.Errorf("expected '%s' at position %d, got '%s'", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *condParser) parseOr() (condExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogical{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseAnd() (condExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOp("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &condLogical{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *condParser) parseUnary() (condExpr, error) {
+	if p.acceptOp("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &condNot{operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *condParser) parseComparison() (condExpr, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.acceptOp(op) {
+			right, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return &condCompare{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *condParser) parsePostfix() (condExpr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		nullSafe := false
+		switch {
+		case p.acceptOp("?."):
+			nullSafe = true
+		case p.acceptOp("."):
+		case p.acceptOp("["):
+			tok := p.next()
+			if tok.typ != condTokString {
+				return nil, fmt.Errorf("expected a string field name at position %d, got '%s'", tok.pos, tok.text)
+			}
+			if err = p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			expr = newCondField(expr, tok.text, false)
+			continue
+		default:
+			return expr, nil
+		}
+		tok := p.next()
+		if tok.typ != condTokIdent {
+			return nil, fmt.Errorf("expected a name at position %d, got '%s'", tok.pos, tok.text)
+		}
+		if !p.acceptOp("(") {
+			expr = newCondField(expr, tok.text, nullSafe)
+			continue
+		}
+		call := &condCall{obj: expr, method: tok.text, nullSafe: nullSafe}
+		if !p.acceptOp(")") {
+			for {
+				arg, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+				if p.acceptOp(")") {
+					break
+				}
+				if err = p.expectOp(","); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, ok := condMethods[call.method]; !ok {
+			return nil, fmt.Errorf("unsupported method '%s' at position %d", call.method, tok.pos)
+		}
+		if n := condMethodArity[call.method]; len(call.args) != n {
+			return nil, fmt.Errorf("%s() takes %d argument(s), got %d, at position %d",
+				call.method, n, len(call.args), tok.pos)
+		}
+		expr = call
+	}
+}
+
+func (p *condParser) parsePrimary() (condExpr, error) {
+	tok := p.next()
+	switch tok.typ {
+	case condTokString:
+		return &condLiteral{tok.text}, nil
+	case condTokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+		}
+		return &condLiteral{f}, nil
+	case condTokIdent:
+		switch tok.text {
+		case "ctx":
+			return &condCtx{}, nil
+		case "true":
+			return &condLiteral{true}, nil
+		case "false":
+			return &condLiteral{false}, nil
+		case "null":
+			return &condLiteral{nil}, nil
+		}
+		return nil, fmt.Errorf("unsupported identifier '%s' at position %d (only 'ctx' fields are supported)", tok.text, tok.pos)
+	case condTokOp:
+		if tok.text == "(" {
+			expr, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
+
+// ---- Evaluation
+
+type condLiteral struct {
+	val interface{}
+}
+
+func (e *condLiteral) eval(d *document) (interface{}, error) {
+	return e.val, nil
+}
+
+type condCtx struct{}
+
+func (e *condCtx) eval(d *document) (interface{}, error) {
+	return d.root, nil
+}
+
+type condField struct {
+	obj      condExpr
+	name     string
+	nullSafe bool
+	// path is the full field path for a field access on `ctx`, e.g.
+	// ["log", "level"] for `ctx.log.level`.
+	path []string
+}
+
+func newCondField(obj condExpr, name string, nullSafe bool) *condField {
+	e := &condField{obj: obj, name: name, nullSafe: nullSafe}
+	switch o := obj.(type) {
+	case *condCtx:
+		e.path = []string{name}
+	case *condField:
+		if o.path != nil {
+			e.path = append(append([]string{}, o.path...), name)
+		}
+	}
+	return e
+}
+
+func (e *condField) eval(d *document) (interface{}, error) {
+	if e.path != nil {
+		if v := jsonutils.LookupValue(d.root, e.path...); v != nil {
+			return condValue(v), nil
+		}
+	}
+	obj, err := e.obj.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		if e.nullSafe {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot access field [%s] of null", e.name)
+	}
+	v, ok := obj.(*fastjson.Value)
+	if !ok || v.Type() != fastjson.TypeObject {
+		return nil, fmt.Errorf("cannot access field [%s] of %s", e.name, condTypeName(obj))
+	}
+	return condValue(v.Get(e.name)), nil
+}
+
+// condValue converts a JSON value to a condition value.
+func condValue(v *fastjson.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch v.Type() {
+	case fastjson.TypeString:
+		return string(v.GetStringBytes())
+	case fastjson.TypeNumber:
+		return v.GetFloat64()
+	case fastjson.TypeTrue:
+		return true
+	case fastjson.TypeFalse:
+		return false
+	case fastjson.TypeNull:
+		return nil
+	}
+	return v
+}
+
+func condTypeName(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *fastjson.Value:
+		if v.Type() == fastjson.TypeArray {
+			return "list"
+		}
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+type condNot struct {
+	operand condExpr
+}
+
+func (e *condNot) eval(d *document) (interface{}, error) {
+	v, err := e.operand.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("cannot apply '!' to %s", condTypeName(v))
+	}
+	return !b, nil
+}
+
+type condLogical struct {
+	op          string // "&&" or "||"
+	left, right condExpr
+}
+
+func (e *condLogical) eval(d *document) (interface{}, error) {
+	for i, operand := range []condExpr{e.left, e.right} {
+		v, err := operand.eval(d)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply '%s' to %s", e.op, condTypeName(v))
+		}
+		// Short-circuit evaluation.
+		if i == 0 && (e.op == "&&" && !b || e.op == "||" && b) {
+			return b, nil
+		}
+		if i == 1 {
+			return b, nil
+		}
+	}
+	return nil, nil // not reached
+}
+
+type condCompare struct {
+	op          string
+	left, right condExpr
+}
+
+func (e *condCompare) eval(d *document) (interface{}, error) {
+	left, err := e.left.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "==":
+		return condEqual(left, right), nil
+	case "!=":
+		return !condEqual(left, right), nil
+	}
+	lf, lok := left.(float64)
+	rf, rok := right.(float64)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot compare %s and %s with '%s'", condTypeName(left), condTypeName(right), e.op)
+	}
+	switch e.op {
+	case "<":
+		return lf < rf, nil
+	case "<=":
+		return lf <= rf, nil
+	case ">":
+		return lf > rf, nil
+	}
+	return lf >= rf, nil
+}
+
+func condEqual(a, b interface{}) bool {
+	av, aok := a.(*fastjson.Value)
+	bv, bok := b.(*fastjson.Value)
+	if aok || bok {
+		return aok && bok && av.String() == bv.String()
+	}
+	return a == b
+}
+
+type condCall struct {
+	obj      condExpr
+	method   string
+	args     []condExpr
+	nullSafe bool
+}
+
+// condMethod implements a method call on a value. It returns an error if
+// the method is not supported for the value's type.
+type condMethod func(recv interface{}, args []interface{}) (interface{}, error)
+
+var condMethods = map[string]condMethod{
+	"contains": func(recv interface{}, args []interface{}) (interface{}, error) {
+		switch r := recv.(type) {
+		case string:
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("contains() argument is not a string")
+			}
+			return strings.Contains(r, s), nil
+		case *fastjson.Value:
+			if r.Type() == fastjson.TypeArray {
+				for _, item := range r.GetArray() {
+					if condEqual(condValue(item), args[0]) {
+						return true, nil
+					}
+				}
+				return false, nil
+			}
+		}
+		return nil, errUnsupportedMethod
+	},
+	"containsKey": func(recv interface{}, args []interface{}) (interface{}, error) {
+		r, ok := recv.(*fastjson.Value)
+		k, kok := args[0].(string)
+		if !ok || !kok || r.Type() != fastjson.TypeObject {
+			return nil, errUnsupportedMethod
+		}
+		return r.Get(k) != nil, nil
+	},
+	"endsWith": stringMethod(func(s string, arg string) interface{} { return strings.HasSuffix(s, arg) }),
+	"equals": func(recv interface{}, args []interface{}) (interface{}, error) {
+		return condEqual(recv, args[0]), nil
+	},
+	"equalsIgnoreCase": stringMethod(func(s string, arg string) interface{} { return strings.EqualFold(s, arg) }),
+	"isEmpty": func(recv interface{}, args []interface{}) (interface{}, error) {
+		n, err := condLen(recv)
+		return n == 0, err
+	},
+	"length": func(recv interface{}, args []interface{}) (interface{}, error) {
+		if s, ok := recv.(string); ok {
+			return float64(len(s)), nil
+		}
+		return nil, errUnsupportedMethod
+	},
+	"size": func(recv interface{}, args []interface{}) (interface{}, error) {
+		if _, ok := recv.(*fastjson.Value); ok {
+			n, err := condLen(recv)
+			return float64(n), err
+		}
+		return nil, errUnsupportedMethod
+	},
+	"startsWith":  stringMethod(func(s string, arg string) interface{} { return strings.HasPrefix(s, arg) }),
+	"toLowerCase": stringMethod(func(s string, _ string) interface{} { return strings.ToLower(s) }),
+	"toUpperCase": stringMethod(func(s string, _ string) interface{} { return strings.ToUpper(s) }),
+	"trim":        stringMethod(func(s string, _ string) interface{} { return strings.TrimSpace(s) }),
+}
+
+// condMethodArity is the number of arguments for each method.
+var condMethodArity = map[string]int{
+	"contains":         1,
+	"containsKey":      1,
+	"endsWith":         1,
+	"equals":           1,
+	"equalsIgnoreCase": 1,
+	"startsWith":       1,
+}
+
+var errUnsupportedMethod = fmt.Errorf("unsupported method")
+
+// stringMethod returns a condMethod for a method on strings that takes zero
+// or one string arguments.
+func stringMethod(fn func(s string, arg string) interface{}) condMethod {
+	return func(recv interface{}, args []interface{}) (interface{}, error) {
+		s, ok := recv.(string)
+		if !ok {
+			return nil, errUnsupportedMethod
+		}
+		var arg string
+		if len(args) > 0 {
+			if arg, ok = args[0].(string); !ok {
+				return nil, fmt.Errorf("argument is not a string")
+			}
+		}
+		return fn(s, arg), nil
+	}
+}
+
+func condLen(v interface{}) (int, error) {
+	switch v := v.(type) {
+	case string:
+		return len(v), nil
+	case *fastjson.Value:
+		if v.Type() == fastjson.TypeArray {
+			return len(v.GetArray()), nil
+		}
+		return v.GetObject().Len(), nil
+	}
+	return 0, errUnsupportedMethod
+}
+
+func (e *condCall) eval(d *document) (interface{}, error) {
+	recv, err := e.obj.eval(d)
+	if err != nil {
+		return nil, err
+	}
+	if recv == nil {
+		if e.nullSafe {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot call %s() on null", e.method)
+	}
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		if args[i], err = a.eval(d); err != nil {
+			return nil, err
+		}
+	}
+	v, err := condMethods[e.method](recv, args)
+	if err == errUnsupportedMethod {
+		return nil, fmt.Errorf("%s() is not supported on %s", e.method, condTypeName(recv))
+	} else if err != nil {
+		return nil, fmt.Errorf("%s(): %s", e.method, err)
+	}
+	return v, nil
+}
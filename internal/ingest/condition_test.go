@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/valyala/fastjson"
+)
+
+type conditionTestCase struct {
+	name      string
+	cond      string
+	rec       string
+	result    bool
+	errSubstr string // expected substring of error from parsing or evaluating
+}
+
+var conditionTestCases = []conditionTestCase{
+	{"literal", "true", `{}`, true, ""},
+	{"field equals", "ctx.a == 'x'", `{"a": "x"}`, true, ""},
+	{"double quoted string", `ctx.a == "x"`, `{"a": "x"}`, true, ""},
+	{"field not equals", "ctx.a != 'x'", `{"a": "x"}`, false, ""},
+	{"missing field is null", "ctx.nope == null", `{}`, true, ""},
+	{"nested field", "ctx.log.level == 'warn'", `{"log": {"level": "warn"}}`, true, ""},
+	{"dotted field name", "ctx.log.level == 'warn'", `{"log.level": "warn"}`, true, ""},
+	{"bracket access", "ctx['log.level'] == 'warn'", `{"log.level": "warn"}`, true, ""},
+	{"null-safe access", "ctx.http?.response?.status_code == null", `{}`, true, ""},
+	{"null access", "ctx.http.response == null", `{}`, false, "cannot access field [response] of null"},
+	{"number comparison", "ctx.code >= 500 && ctx.code < 600", `{"code": 503}`, true, ""},
+	{"number comparison with string", "ctx.code > 'x'", `{"code": 503}`, false, "cannot compare number and string with '>'"},
+	{"or, not, parens", "!(ctx.a == 1 || ctx.b == 2)", `{"a": 0, "b": 2}`, false, ""},
+	{"short-circuit", "ctx.a != null && ctx.a.b == 1", `{}`, false, ""},
+	{"contains", "ctx.message.contains('health')", `{"message": "GET /healthz"}`, true, ""},
+	{"list contains", "ctx.tags.contains('b')", `{"tags": ["a", "b"]}`, true, ""},
+	{"containsKey", "ctx.containsKey('error')", `{"message": "hi"}`, false, ""},
+	{"string methods", "ctx.a.toLowerCase().startsWith('er') && ctx.a.trim().endsWith('OR')", `{"a": "ERROR "}`, true, ""},
+	{"equalsIgnoreCase", "ctx.a.equalsIgnoreCase('warn')", `{"a": "WARN"}`, true, ""},
+	{"isEmpty", "ctx.tags.isEmpty() && !ctx.a.isEmpty()", `{"tags": [], "a": "x"}`, true, ""},
+	{"null-safe method", "ctx.a?.isEmpty() == null", `{}`, true, ""},
+	{"method on null", "ctx.a.isEmpty()", `{}`, false, "cannot call isEmpty() on null"},
+	{"not a boolean", "ctx.a", `{"a": "x"}`, false, "did not evaluate to a boolean (got string)"},
+	{"unsupported method", "ctx.a.matches('x')", `{}`, false, "unsupported method 'matches'"},
+	{"wrong arity", "ctx.a.contains()", `{}`, false, "contains() takes 1 argument(s), got 0"},
+	{"unsupported identifier", "params.x == 1", `{}`, false, "unsupported identifier 'params'"},
+	{"unterminated string", "ctx.a == 'x", `{}`, false, "unterminated string"},
+	{"trailing tokens", "ctx.a == 1 ctx", `{}`, false, "unexpected 'ctx' at position 11"},
+}
+
+func TestCondition(t *testing.T) {
+	for _, tc := range conditionTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result bool
+			c, err := parseCondition(tc.cond)
+			if err == nil {
+				var arena fastjson.Arena
+				d := &document{root: fastjson.MustParse(tc.rec), arena: &arena}
+				result, err = c.eval(d)
+			}
+			if !equalErrSubstr(err, tc.errSubstr) {
+				t.Errorf("%s:\ncondition:\n\t%s\ngot error:\n\t%v\nexpected error with this substring:\n\t%q\n",
+					tc.name, tc.cond, err, tc.errSubstr)
+			}
+			if result != tc.result {
+				t.Errorf("%s:\ncondition:\n\t%s\ngot %v, expected %v", tc.name, tc.cond, result, tc.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package ingest
+
+// The "date" processor.
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iso8601Layouts are the layouts tried for the "ISO8601" date format.
+var iso8601Layouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// javaDateTokens maps Java date pattern letters, as used by Elasticsearch
+// date formats, to Go time layout elements. Longer tokens are listed first.
+var javaDateTokens = []struct {
+	java, golang string
+}{
+	{"yyyy", "2006"},
+	{"uuuu", "2006"},
+	{"yy", "06"},
+	{"uu", "06"},
+	{"MMMM", "January"},
+	{"MMM", "Jan"},
+	{"MM", "01"},
+	{"M", "1"},
+	{"dd", "02"},
+	{"d", "2"},
+	{"EEEE", "Monday"},
+	{"EEE", "Mon"},
+	{"HH", "15"},
+	{"H", "15"},
+	{"hh", "03"},
+	{"h", "3"},
+	{"mm", "04"},
+	{"m", "4"},
+	{"ss", "05"},
+	{"s", "5"},
+	{"a", "PM"},
+	{"XXX", "Z07:00"},
+	{"XX", "Z0700"},
+	{"X", "Z07"},
+	{"ZZ", "-07:00"},
+	{"Z", "-0700"},
+	{"z", "MST"},
+}
+
+// javaDateLayout converts a Java date pattern, e.g. "dd/MMM/yyyy:HH:mm:ss Z",
+// to a Go time layout.
+func javaDateLayout(pattern string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			// A quoted literal, e.g. 'T'. Two single quotes are a literal
+			// single quote.
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated quote in date format [%s]", pattern)
+			}
+			if end == 0 {
+				b.WriteByte('\'')
+			} else {
+				b.WriteString(pattern[i+1 : i+1+end])
+			}
+			i += end + 2
+		case c == 'S':
+			n := 1
+			for i+n < len(pattern) && pattern[i+n] == 'S' {
+				n++
+			}
+			b.WriteString(strings.Repeat("0", n))
+			i += n
+		case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			found := false
+			for _, tok := range javaDateTokens {
+				if strings.HasPrefix(pattern[i:], tok.java) {
+					b.WriteString(tok.golang)
+					i += len(tok.java)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return "", fmt.Errorf("unsupported pattern letter '%c' in date format [%s]", c, pattern)
+			}
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+// dateFormat parses a date string in one of the formats supported by the
+// "date" processor.
+type dateFormat func(s string, loc *time.Location) (time.Time, error)
+
+func newDateFormat(format string) (dateFormat, error) {
+	switch format {
+	case "ISO8601":
+		return func(s string, loc *time.Location) (time.Time, error) {
+			for _, layout := range iso8601Layouts {
+				if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+					return t, nil
+				}
+			}
+			return time.Time{}, fmt.Errorf("failed to parse date [%s] with format [ISO8601]", s)
+		}, nil
+	case "UNIX":
+		return func(s string, loc *time.Location) (time.Time, error) {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse date [%s] with format [UNIX]", s)
+			}
+			sec, frac := math.Modf(f)
+			return time.Unix(int64(sec), int64(math.Round(frac*1e3))*1e6), nil
+		}, nil
+	case "UNIX_MS":
+		return func(s string, loc *time.Location) (time.Time, error) {
+			ms, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse date [%s] with format [UNIX_MS]", s)
+			}
+			return time.Unix(0, ms*int64(time.Millisecond)), nil
+		}, nil
+	case "TAI64N":
+		return nil, fmt.Errorf("unsupported date format [%s]", format)
+	}
+	layout, err := javaDateLayout(format)
+	if err != nil {
+		return nil, err
+	}
+	return func(s string, loc *time.Location) (time.Time, error) {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse date [%s] with format [%s]", s, format)
+		}
+		return t, nil
+	}, nil
+}
+
+type dateProcessor struct {
+	field        string
+	targetField  string
+	formats      []dateFormat
+	loc          *time.Location
+	outputLayout string
+}
+
+func newDateProcessor(opts *options) (processor, error) {
+	p := &dateProcessor{
+		field:        opts.requiredString("field"),
+		targetField:  opts.string("target_field"),
+		loc:          time.UTC,
+		outputLayout: "2006-01-02T15:04:05.000Z07:00",
+	}
+	if p.targetField == "" {
+		p.targetField = "@timestamp"
+	}
+	opts.string("locale")
+	if tz := opts.string("timezone"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'timezone' [%s]: %s", tz, err)
+		}
+		p.loc = loc
+	}
+	if of := opts.string("output_format"); of != "" {
+		layout, err := javaDateLayout(of)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'output_format': %s", err)
+		}
+		p.outputLayout = layout
+	}
+	formats := opts.strings("formats")
+	if len(formats) == 0 && opts.err == nil {
+		return nil, fmt.Errorf("'formats' is required")
+	}
+	for _, f := range formats {
+		df, err := newDateFormat(f)
+		if err != nil {
+			return nil, err
+		}
+		p.formats = append(p.formats, df)
+	}
+	return p, nil
+}
+
+func (p *dateProcessor) run(d *document) error {
+	v := d.getField(p.field)
+	if v == nil {
+		return fmt.Errorf("field [%s] not present as part of path [%s]", p.field, p.field)
+	}
+	s, err := stringValue(v)
+	if err != nil {
+		return fmt.Errorf("field [%s] %s", p.field, err)
+	}
+	var t time.Time
+	for _, f := range p.formats {
+		if t, err = f(s, p.loc); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse date [%s]", s)
+	}
+	return d.setField(p.targetField, d.arena.NewString(t.In(p.loc).Format(p.outputLayout)))
+}
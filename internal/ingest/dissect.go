@@ -0,0 +1,215 @@
+package ingest
+
+// The "dissect" processor.
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dissectKeyRe matches a dissect key, e.g. "%{foo}", "%{+foo/2}", or
+// "%{?foo->}".
+var dissectKeyRe = regexp.MustCompile(`%\{([^}]*)\}`)
+
+// dissectKey is a parsed dissect key.
+type dissectKey struct {
+	name       string
+	modifier   byte // 0, '?' (skip), '+' (append), '*' (reference key), or '&' (reference value)
+	order      int  // the "/N" order for append keys
+	rightPad   bool // the "->" modifier: skip repeated delimiters after the value
+	appendSeq  int  // the position of this key among append keys of the same name
+	hasOrder   bool
+	delimAfter string
+}
+
+type dissectProcessor struct {
+	field           string
+	pattern         string
+	prefix          string // literal text before the first key
+	keys            []dissectKey
+	appendSeparator string
+	ignoreMissing   bool
+}
+
+func newDissectProcessor(opts *options) (processor, error) {
+	p := &dissectProcessor{
+		field:           opts.requiredString("field"),
+		pattern:         opts.requiredString("pattern"),
+		appendSeparator: opts.string("append_separator"),
+		ignoreMissing:   opts.bool("ignore_missing"),
+	}
+	if opts.err != nil {
+		return p, nil
+	}
+	if err := p.parsePattern(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *dissectProcessor) parsePattern() error {
+	locs := dissectKeyRe.FindAllStringSubmatchIndex(p.pattern, -1)
+	if len(locs) == 0 {
+		return fmt.Errorf("unable to find any keys in dissect pattern [%s]", p.pattern)
+	}
+	p.prefix = p.pattern[:locs[0][0]]
+	numAppends := make(map[string]int)
+	for i, loc := range locs {
+		k := dissectKey{name: p.pattern[loc[2]:loc[3]]}
+		if strings.HasSuffix(k.name, "->") {
+			k.rightPad = true
+			k.name = strings.TrimSuffix(k.name, "->")
+		}
+		if k.name != "" {
+			switch k.name[0] {
+			case '?', '+', '*', '&':
+				k.modifier = k.name[0]
+				k.name = k.name[1:]
+			}
+		}
+		if k.modifier == '+' {
+			if slash := strings.LastIndexByte(k.name, '/'); slash != -1 {
+				n, err := strconv.Atoi(k.name[slash+1:])
+				if err != nil {
+					return fmt.Errorf("invalid append order in dissect key [%s]", p.pattern[loc[0]:loc[1]])
+				}
+				k.order = n
+				k.hasOrder = true
+				k.name = k.name[:slash]
+			}
+			k.appendSeq = numAppends[k.name]
+			numAppends[k.name]++
+		}
+		if k.name == "" && k.modifier != 0 && k.modifier != '?' {
+			return fmt.Errorf("invalid dissect key [%s] in pattern [%s]", p.pattern[loc[0]:loc[1]], p.pattern)
+		}
+		if i+1 < len(locs) {
+			k.delimAfter = p.pattern[loc[1]:locs[i+1][0]]
+			if k.delimAfter == "" {
+				return fmt.Errorf("dissect pattern [%s] has consecutive keys without a delimiter", p.pattern)
+			}
+		} else {
+			k.delimAfter = p.pattern[loc[1]:]
+		}
+		p.keys = append(p.keys, k)
+	}
+	return nil
+}
+
+func (p *dissectProcessor) run(d *document) error {
+	s, ok, err := d.stringField(p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	noMatch := fmt.Errorf("Unable to find match for dissect pattern: %s against source: %s", p.pattern, s)
+	if !strings.HasPrefix(s, p.prefix) {
+		return noMatch
+	}
+	rest := s[len(p.prefix):]
+	values := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		last := i == len(p.keys)-1
+		if last && k.delimAfter == "" {
+			values[i] = rest
+			rest = ""
+			break
+		}
+		idx := strings.Index(rest, k.delimAfter)
+		if idx == -1 {
+			return noMatch
+		}
+		if last && !strings.HasSuffix(rest, k.delimAfter) {
+			return noMatch
+		}
+		if last {
+			idx = len(rest) - len(k.delimAfter)
+		}
+		values[i] = rest[:idx]
+		rest = rest[idx+len(k.delimAfter):]
+		if k.rightPad {
+			for !last && strings.HasPrefix(rest, k.delimAfter) {
+				rest = rest[len(k.delimAfter):]
+			}
+		}
+	}
+
+	// Gather append values, in order, and reference keys.
+	type appendVal struct {
+		key   dissectKey
+		value string
+	}
+	appends := make(map[string][]appendVal)
+	var appendNames []string
+	refValues := make(map[string]string)
+	for i, k := range p.keys {
+		switch k.modifier {
+		case '?':
+			// skipped
+		case '+':
+			if _, ok := appends[k.name]; !ok {
+				appendNames = append(appendNames, k.name)
+			}
+			appends[k.name] = append(appends[k.name], appendVal{k, values[i]})
+		case '*':
+			// handled below
+		case '&':
+			refValues[k.name] = values[i]
+		default:
+			if k.name == "" {
+				continue
+			}
+			if err := d.setField(k.name, d.arena.NewString(values[i])); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range appendNames {
+		vals := appends[name]
+		sort.SliceStable(vals, func(i, j int) bool {
+			oi, oj := vals[i].key.appendSeq, vals[j].key.appendSeq
+			if vals[i].key.hasOrder {
+				oi = vals[i].key.order
+			}
+			if vals[j].key.hasOrder {
+				oj = vals[j].key.order
+			}
+			return oi < oj
+		})
+		parts := make([]string, len(vals))
+		for i, av := range vals {
+			parts[i] = av.value
+		}
+		// A plain key with the same name is the first value to append to.
+		if existing, ok := p.plainValue(name, values); ok {
+			parts = append([]string{existing}, parts...)
+		}
+		if err := d.setField(name, d.arena.NewString(strings.Join(parts, p.appendSeparator))); err != nil {
+			return err
+		}
+	}
+	for i, k := range p.keys {
+		if k.modifier != '*' {
+			continue
+		}
+		if v, ok := refValues[k.name]; ok {
+			if err := d.setField(values[i], d.arena.NewString(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// plainValue returns the value matched by a key without a modifier with the
+// given name, if any.
+func (p *dissectProcessor) plainValue(name string, values []string) (string, bool) {
+	for i, k := range p.keys {
+		if k.modifier == 0 && k.name == name {
+			return values[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,253 @@
+package ingest
+
+// The "grok" processor.
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// grokPatterns is the built-in grok pattern library: a subset of the
+// Elasticsearch "legacy" patterns
+// (https://github.com/elastic/elasticsearch/tree/master/libs/grok/src/main/resources/patterns/legacy).
+// Some patterns are simplified, because Go's regexp package does not support
+// lookaround or atomic groups.
+var grokPatterns = map[string]string{
+	"USERNAME":          `[a-zA-Z0-9._-]+`,
+	"USER":              `%{USERNAME}`,
+	"EMAILLOCALPART":    `[a-zA-Z][a-zA-Z0-9_.+-=:]+`,
+	"EMAILADDRESS":      `%{EMAILLOCALPART}@%{HOSTNAME}`,
+	"INT":               `(?:[+-]?(?:[0-9]+))`,
+	"BASE10NUM":         `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":            `(?:%{BASE10NUM})`,
+	"BASE16NUM":         `(?:[+-]?(?:0x)?(?:[0-9A-Fa-f]+))`,
+	"POSINT":            `\b(?:[1-9][0-9]*)\b`,
+	"NONNEGINT":         `\b(?:[0-9]+)\b`,
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|` + "`(?:[^`\\\\]|\\\\.)*`)",
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"MAC":               `(?:%{CISCOMAC}|%{WINDOWSMAC}|%{COMMONMAC})`,
+	"CISCOMAC":          `(?:(?:[A-Fa-f0-9]{4}\.){2}[A-Fa-f0-9]{4})`,
+	"WINDOWSMAC":        `(?:(?:[A-Fa-f0-9]{2}-){5}[A-Fa-f0-9]{2})`,
+	"COMMONMAC":         `(?:(?:[A-Fa-f0-9]{2}:){5}[A-Fa-f0-9]{2})`,
+	"IPV6":              `(?:(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){1,7}:|(?:[0-9A-Fa-f]{1,4}:){1,6}:[0-9A-Fa-f]{1,4}|(?:[0-9A-Fa-f]{1,4}:){1,5}(?::[0-9A-Fa-f]{1,4}){1,2}|(?:[0-9A-Fa-f]{1,4}:){1,4}(?::[0-9A-Fa-f]{1,4}){1,3}|(?:[0-9A-Fa-f]{1,4}:){1,3}(?::[0-9A-Fa-f]{1,4}){1,4}|(?:[0-9A-Fa-f]{1,4}:){1,2}(?::[0-9A-Fa-f]{1,4}){1,5}|[0-9A-Fa-f]{1,4}:(?::[0-9A-Fa-f]{1,4}){1,6}|:(?:(?::[0-9A-Fa-f]{1,4}){1,7}|:))(?:%[0-9A-Za-z]+)?`,
+	"IPV4":              `(?:(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])\.){3}(?:25[0-5]|2[0-4][0-9]|1[0-9]{2}|[1-9]?[0-9])`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b(?:[0-9A-Za-z][0-9A-Za-z-]{0,62})(?:\.(?:[0-9A-Za-z][0-9A-Za-z-]{0,62}))*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":          `%{IPORHOST}:%{POSINT}`,
+	"PATH":              `(?:%{UNIXPATH}|%{WINPATH})`,
+	"UNIXPATH":          `(?:/[\w_%!$@:.,+~-]*)+`,
+	"TTY":               `(?:/dev/(?:pts|tty(?:[pq])?)(?:\w+)?/?(?:[0-9]+))`,
+	"WINPATH":           `(?:[A-Za-z]+:|\\)(?:\\[^\\?*]*)+`,
+	"URIPROTO":          `[A-Za-z](?:[A-Za-z0-9+\-.]+)+`,
+	"URIHOST":           `%{IPORHOST}(?::%{POSINT})?`,
+	"URIPATH":           `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIQUERY":          `[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPARAM":          `\?%{URIQUERY}`,
+	"URIPATHPARAM":      `%{URIPATH}(?:%{URIPARAM})?`,
+	"URI":               `%{URIPROTO}://(?:%{USER}(?::[^@]*)?@)?(?:%{URIHOST})?(?:%{URIPATHPARAM})?`,
+	"MONTH":             `\b(?:[Jj]an(?:uary|uar)?|[Ff]eb(?:ruary|ruar)?|[Mm](?:a|ä)?r(?:ch|z)?|[Aa]pr(?:il)?|[Mm]a(?:y|i)?|[Jj]un(?:e|i)?|[Jj]ul(?:y|i)?|[Aa]ug(?:ust)?|[Ss]ep(?:tember)?|[Oo](?:c|k)?t(?:ober)?|[Nn]ov(?:ember)?|[Dd]e(?:c|z)(?:ember)?)\b`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHNUM2":         `(?:0[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:(?:0[1-9])|(?:[12][0-9])|(?:3[01])|[1-9])`,
+	"DAY":               `(?:Mon(?:day)?|Tue(?:sday)?|Wed(?:nesday)?|Thu(?:rsday)?|Fri(?:day)?|Sat(?:urday)?|Sun(?:day)?)`,
+	"YEAR":              `(?:\d\d){1,2}`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})`,
+	"DATE_US":           `%{MONTHNUM}[/-]%{MONTHDAY}[/-]%{YEAR}`,
+	"DATE_EU":           `%{MONTHDAY}[./-]%{MONTHNUM}[./-]%{YEAR}`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"ISO8601_SECOND":    `%{SECOND}`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"DATE":              `%{DATE_US}|%{DATE_EU}`,
+	"DATESTAMP":         `%{DATE}[- ]%{TIME}`,
+	"TZ":                `(?:[APMCE][SD]T|UTC)`,
+	"DATESTAMP_RFC822":  `%{DAY} %{MONTH} %{MONTHDAY} %{YEAR} %{TIME} %{TZ}`,
+	"DATESTAMP_RFC2822": `%{DAY}, %{MONTHDAY} %{MONTH} %{YEAR} %{TIME} %{ISO8601_TIMEZONE}`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+	"PROG":              `[\x21-\x5a\x5c\x5e-\x7e]+`,
+	"SYSLOGPROG":        `%{PROG:program}(?:\[%{POSINT:pid}\])?`,
+	"SYSLOGHOST":        `%{IPORHOST}`,
+	"LOGLEVEL":          `(?:[Aa]lert|ALERT|[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo?(?:rmation)?|INFO?(?:RMATION)?|[Ww]arn?(?:ing)?|WARN?(?:ING)?|[Ee]rr?(?:or)?|ERR?(?:OR)?|[Cc]rit?(?:ical)?|CRIT?(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|EMERG(?:ENCY)?|[Ee]merg(?:ency)?)`,
+}
+
+// grokRefRe matches a grok pattern reference: %{SYNTAX}, %{SYNTAX:SEMANTIC},
+// or %{SYNTAX:SEMANTIC:TYPE}.
+var grokRefRe = regexp.MustCompile(`%\{(\w+)(?::([\w.@\[\]-]+))?(?::(\w+))?\}`)
+
+// grokCapture is a named capture in a compiled grok expression.
+type grokCapture struct {
+	field string
+	typ   string // "", "int", "long", "float", "double", or "boolean"
+}
+
+// grokExpr is a compiled grok expression.
+type grokExpr struct {
+	re       *regexp.Regexp
+	captures map[string]grokCapture // by regexp group name
+}
+
+// compileGrok compiles a grok expression, e.g.
+// "%{IP:client.ip} %{WORD:http.request.method}", to a Go regexp.
+func compileGrok(expr string, defs map[string]string) (*grokExpr, error) {
+	g := &grokExpr{captures: make(map[string]grokCapture)}
+	expanded, err := g.expand(expr, defs, nil)
+	if err != nil {
+		return nil, err
+	}
+	g.re, err = regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grok expression [%s]: %s", expr, err)
+	}
+	return g, nil
+}
+
+// expand replaces pattern references in `expr` with their regexps.
+// `stack` is the names of the patterns being expanded, to detect cycles.
+func (g *grokExpr) expand(expr string, defs map[string]string, stack []string) (string, error) {
+	var err error
+	expanded := grokRefRe.ReplaceAllStringFunc(expr, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		m := grokRefRe.FindStringSubmatch(ref)
+		name, field, typ := m[1], m[2], m[3]
+		for _, s := range stack {
+			if s == name {
+				err = fmt.Errorf("circular reference in grok pattern [%s]", name)
+				return ""
+			}
+		}
+		def, ok := defs[name]
+		if !ok {
+			def, ok = grokPatterns[name]
+		}
+		if !ok {
+			err = fmt.Errorf("unable to find pattern [%s] in grok's pattern dictionary", name)
+			return ""
+		}
+		var sub string
+		if sub, err = g.expand(def, defs, append(stack, name)); err != nil {
+			return ""
+		}
+		if field == "" {
+			return "(?:" + sub + ")"
+		}
+		switch typ {
+		case "", "int", "long", "float", "double", "boolean":
+		default:
+			err = fmt.Errorf("unsupported grok type [%s] for field [%s]", typ, field)
+			return ""
+		}
+		group := fmt.Sprintf("g%d", len(g.captures))
+		// Elasticsearch also accepts the "[a][b]" form of field names.
+		if strings.HasPrefix(field, "[") {
+			field = strings.Replace(strings.Trim(field, "[]"), "][", ".", -1)
+		}
+		g.captures[group] = grokCapture{field: field, typ: typ}
+		return "(?P<" + group + ">" + sub + ")"
+	})
+	return expanded, err
+}
+
+// ---- grok processor
+
+type grokProcessor struct {
+	field         string
+	exprs         []*grokExpr
+	ignoreMissing bool
+}
+
+func newGrokProcessor(opts *options) (processor, error) {
+	p := &grokProcessor{
+		field:         opts.requiredString("field"),
+		ignoreMissing: opts.bool("ignore_missing"),
+	}
+	defs := make(map[string]string)
+	if dv := opts.get("pattern_definitions"); dv != nil {
+		obj, err := dv.Object()
+		if err != nil {
+			return nil, fmt.Errorf("'pattern_definitions' is not an object")
+		}
+		obj.Visit(func(k []byte, v *fastjson.Value) {
+			defs[string(k)] = string(v.GetStringBytes())
+		})
+	}
+	opts.get("trace_match")
+	opts.get("ecs_compatibility")
+	patterns := opts.strings("patterns")
+	if len(patterns) == 0 && opts.err == nil {
+		return nil, fmt.Errorf("'patterns' is required")
+	}
+	for _, pat := range patterns {
+		g, err := compileGrok(pat, defs)
+		if err != nil {
+			return nil, err
+		}
+		p.exprs = append(p.exprs, g)
+	}
+	return p, nil
+}
+
+func (p *grokProcessor) run(d *document) error {
+	s, ok, err := d.stringField(p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	for _, g := range p.exprs {
+		m := g.re.FindStringSubmatch(s)
+		if m == nil {
+			continue
+		}
+		for i, name := range g.re.SubexpNames() {
+			c, ok := g.captures[name]
+			if !ok || m[i] == "" {
+				continue
+			}
+			v, err := c.value(d, m[i])
+			if err != nil {
+				return err
+			}
+			if err = d.setField(c.field, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Provided Grok expressions do not match field value: [%s]", s)
+}
+
+// value returns the captured string `s` converted to the capture's type.
+func (c grokCapture) value(d *document, s string) (*fastjson.Value, error) {
+	switch c.typ {
+	case "int", "long":
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s for field [%s]", s, c.typ, c.field)
+		}
+		return d.arena.NewNumberString(s), nil
+	case "float", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s for field [%s]", s, c.typ, c.field)
+		}
+		return d.arena.NewNumberFloat64(f), nil
+	case "boolean":
+		if strings.EqualFold(s, "true") {
+			return d.arena.NewTrue(), nil
+		}
+		return d.arena.NewFalse(), nil
+	}
+	return d.arena.NewString(s), nil
+}
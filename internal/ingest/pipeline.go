@@ -0,0 +1,477 @@
+package ingest
+
+// Run a subset of Elasticsearch ingest pipeline processors on log records.
+// See README.md for the supported subset.
+//
+// Usage:
+//     p, err := ingest.Load(pipelineJSON)
+//     if err != nil {
+//         panic(err.Error())
+//     }
+//     err = p.Run(rec, &arena)
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/trentm/go-ecslog/internal/jsonutils"
+	"github.com/valyala/fastjson"
+)
+
+// Pipeline is a loaded ingest pipeline definition.
+type Pipeline struct {
+	steps     []*step
+	onFailure []*step
+}
+
+// processor is the interface for the type-specific part of a processor.
+type processor interface {
+	run(d *document) error
+}
+
+// newProcessorFn creates a processor from its options. It must use (and so
+// remove) each supported option from `opts`, so that unsupported options can
+// be reported.
+type newProcessorFn func(opts *options) (processor, error)
+
+var newProcessorFromType = map[string]newProcessorFn{
+	"convert":   newConvertProcessor,
+	"date":      newDateProcessor,
+	"dissect":   newDissectProcessor,
+	"grok":      newGrokProcessor,
+	"json":      newJSONProcessor,
+	"lowercase": newLowercaseProcessor,
+	"remove":    newRemoveProcessor,
+	"rename":    newRenameProcessor,
+	"set":       newSetProcessor,
+}
+
+// step is a processor in a pipeline, with the options common to all
+// processors.
+type step struct {
+	typ           string
+	tag           string
+	proc          processor
+	cond          *condition
+	ignoreFailure bool
+	onFailure     []*step
+}
+
+// document is a record being processed by a pipeline.
+type document struct {
+	root  *fastjson.Value
+	arena *fastjson.Arena
+	// failure is the failure being handled while running "on_failure"
+	// processors, if any.
+	failure *failure
+}
+
+// failure is the metadata about a processor failure, available in
+// "on_failure" processors as "_ingest.on_failure_message", etc.
+type failure struct {
+	message       string
+	processorType string
+	processorTag  string
+}
+
+// Load loads an ingest pipeline definition: the JSON body of a
+// `PUT _ingest/pipeline/NAME` request, e.g.:
+//     {"processors": [{"rename": {"field": "msg", "target_field": "message"}}]}
+func Load(data []byte) (*Pipeline, error) {
+	v, err := fastjson.ParseBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline JSON: %s", err)
+	}
+	opts, err := newOptions(v, "pipeline")
+	if err != nil {
+		return nil, err
+	}
+	opts.string("description")
+	opts.get("version")
+	opts.get("_meta")
+
+	p := &Pipeline{}
+	processors := opts.get("processors")
+	if processors == nil {
+		return nil, fmt.Errorf("invalid pipeline: missing 'processors'")
+	}
+	if p.steps, err = loadSteps(processors, "processors"); err != nil {
+		return nil, err
+	}
+	if onFailure := opts.get("on_failure"); onFailure != nil {
+		if p.onFailure, err = loadSteps(onFailure, "on_failure"); err != nil {
+			return nil, err
+		}
+	}
+	if err = opts.finish(); err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %s", err)
+	}
+	return p, nil
+}
+
+// loadSteps loads an array of processor definitions, e.g.
+//     [{"set": {...}}, {"remove": {...}}]
+func loadSteps(v *fastjson.Value, where string) ([]*step, error) {
+	arr, err := v.Array()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: '%s' is not an array", where)
+	}
+	var steps []*step
+	for i, pv := range arr {
+		pwhere := fmt.Sprintf("%s[%d]", where, i)
+		obj, err := pv.Object()
+		if err != nil || obj.Len() != 1 {
+			return nil, fmt.Errorf("invalid pipeline: %s is not an object with a single processor type", pwhere)
+		}
+		var typ string
+		var ov *fastjson.Value
+		obj.Visit(func(k []byte, v *fastjson.Value) {
+			typ = string(k)
+			ov = v
+		})
+		newProc, ok := newProcessorFromType[typ]
+		if !ok {
+			var known []string
+			for t := range newProcessorFromType {
+				known = append(known, t)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("invalid pipeline: %s: unsupported processor '%s' (supported processors: %s)",
+				pwhere, typ, strings.Join(known, ", "))
+		}
+		pwhere += " (" + typ + ")"
+		s, err := loadStep(typ, newProc, ov, pwhere)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+func loadStep(typ string, newProc newProcessorFn, v *fastjson.Value, where string) (*step, error) {
+	opts, err := newOptions(v, where)
+	if err != nil {
+		return nil, err
+	}
+	s := &step{typ: typ}
+	s.tag = opts.string("tag")
+	opts.string("description")
+	s.ignoreFailure = opts.bool("ignore_failure")
+	if cv := opts.get("if"); cv != nil {
+		// The condition is a Painless script: either the source string, or
+		// an object with a "source" string.
+		var src []byte
+		if cv.Type() == fastjson.TypeObject {
+			src = cv.GetStringBytes("source")
+			if lang := cv.GetStringBytes("lang"); lang != nil && string(lang) != "painless" {
+				return nil, fmt.Errorf("invalid pipeline: %s: unsupported 'if' script lang '%s'", where, lang)
+			}
+		} else {
+			src = cv.GetStringBytes()
+		}
+		if src == nil {
+			return nil, fmt.Errorf("invalid pipeline: %s: 'if' is not a string", where)
+		}
+		if s.cond, err = parseCondition(string(src)); err != nil {
+			return nil, fmt.Errorf("invalid pipeline: %s: unsupported 'if' condition: %s", where, err)
+		}
+	}
+	if onFailure := opts.get("on_failure"); onFailure != nil {
+		if s.onFailure, err = loadSteps(onFailure, where+".on_failure"); err != nil {
+			return nil, err
+		}
+	}
+	if s.proc, err = newProc(opts); err == nil {
+		err = opts.finish()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %s: %s", where, err)
+	}
+	return s, nil
+}
+
+// Run runs the pipeline on the record, modifying it in place. New values are
+// allocated from the given arena.
+//
+// As with Elasticsearch, if a processor fails (and has no "on_failure"
+// processors and is not "ignore_failure") then the pipeline's "on_failure"
+// processors are run, if any, and then processing stops. Otherwise, the
+// failure is returned.
+func (p *Pipeline) Run(rec *fastjson.Value, arena *fastjson.Arena) error {
+	d := &document{root: rec, arena: arena}
+	return runSteps(d, p.steps, p.onFailure)
+}
+
+func runSteps(d *document, steps, onFailure []*step) error {
+	for _, s := range steps {
+		err := s.run(d)
+		if err == nil {
+			continue
+		}
+		if len(onFailure) == 0 {
+			return err
+		}
+		return handleFailure(d, err, onFailure)
+	}
+	return nil
+}
+
+// handleFailure runs the "on_failure" processors for a processor failure.
+func handleFailure(d *document, err error, onFailure []*step) error {
+	prev := d.failure
+	if pe, ok := err.(*processorError); ok {
+		d.failure = &pe.failure
+	}
+	err = runSteps(d, onFailure, nil)
+	d.failure = prev
+	return err
+}
+
+// processorError is the error from a failed processor.
+type processorError struct {
+	failure
+}
+
+func (e *processorError) Error() string {
+	if e.processorTag != "" {
+		return fmt.Sprintf("%s processor [%s] failed: %s", e.processorType, e.processorTag, e.message)
+	}
+	return fmt.Sprintf("%s processor failed: %s", e.processorType, e.message)
+}
+
+func (s *step) run(d *document) error {
+	if s.cond != nil {
+		ok, err := s.cond.eval(d)
+		if err != nil {
+			return s.failed(d, err)
+		} else if !ok {
+			return nil
+		}
+	}
+	if err := s.proc.run(d); err != nil {
+		return s.failed(d, err)
+	}
+	return nil
+}
+
+// failed handles a failure of the step's processor.
+func (s *step) failed(d *document, err error) error {
+	if _, ok := err.(*processorError); !ok {
+		err = &processorError{failure{message: err.Error(), processorType: s.typ, processorTag: s.tag}}
+	}
+	if len(s.onFailure) > 0 {
+		err = handleFailure(d, err, s.onFailure)
+	}
+	if err != nil && s.ignoreFailure {
+		return nil
+	}
+	return err
+}
+
+// ---- Field access
+
+func splitField(name string) []string {
+	return strings.Split(name, ".")
+}
+
+// getField returns the value of the (dotted) field name, or nil if it does
+// not exist. Metadata fields from a failure, e.g.
+// "_ingest.on_failure_message", are available while handling the failure.
+func (d *document) getField(name string) *fastjson.Value {
+	if d.failure != nil && strings.HasPrefix(name, "_ingest.") {
+		switch name {
+		case "_ingest.on_failure_message":
+			return d.arena.NewString(d.failure.message)
+		case "_ingest.on_failure_processor_type":
+			return d.arena.NewString(d.failure.processorType)
+		case "_ingest.on_failure_processor_tag":
+			return d.arena.NewString(d.failure.processorTag)
+		}
+	}
+	return jsonutils.LookupValue(d.root, splitField(name)...)
+}
+
+// setField sets the (dotted) field name to the given value. If the field
+// does not exist, it is created with objects for each part of the name, as
+// Elasticsearch does, e.g. setting "a.b" on `{}` results in `{"a":{"b":...}}`.
+func (d *document) setField(name string, v *fastjson.Value) error {
+	path := splitField(name)
+	if jsonutils.LookupValue(d.root, path...) != nil {
+		jsonutils.SetValue(d.root, v, path...)
+		return nil
+	}
+	obj := d.root
+	for i, key := range path[:len(path)-1] {
+		sub := obj.Get(key)
+		if sub == nil {
+			sub = d.arena.NewObject()
+			obj.Set(key, sub)
+		} else if sub.Type() != fastjson.TypeObject {
+			return fmt.Errorf("cannot set [%s] with parent object of type [%s] as part of path [%s]",
+				path[i+1], sub.Type(), name)
+		}
+		obj = sub
+	}
+	obj.Set(path[len(path)-1], v)
+	return nil
+}
+
+// removeField removes the (dotted) field name, returning false if it does not
+// exist.
+func (d *document) removeField(name string) bool {
+	return jsonutils.ExtractValue(d.root, splitField(name)...) != nil
+}
+
+// stringField returns the value of the (dotted) field name, which must be a
+// string. If the field does not exist, it returns ok=false, or an error if
+// `ignoreMissing` is false.
+func (d *document) stringField(name string, ignoreMissing bool) (s string, ok bool, err error) {
+	v := d.getField(name)
+	if v == nil || v.Type() == fastjson.TypeNull {
+		if ignoreMissing {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("field [%s] not present as part of path [%s]", name, name)
+	}
+	if v.Type() != fastjson.TypeString {
+		return "", false, fmt.Errorf("field [%s] of type [%s] cannot be cast to [string]", name, v.Type())
+	}
+	return string(v.GetStringBytes()), true, nil
+}
+
+// stringValue returns the string form of a string or number value, as a
+// processor option that expects a string would use it.
+func stringValue(v *fastjson.Value) (string, error) {
+	switch v.Type() {
+	case fastjson.TypeString:
+		return string(v.GetStringBytes()), nil
+	case fastjson.TypeNumber:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("of type [%s] cannot be cast to [string]", v.Type())
+}
+
+// ---- Processor options
+
+// options is the options object of a processor (or of the pipeline), which
+// tracks the options used so that unsupported options can be reported.
+type options struct {
+	obj   *fastjson.Object
+	where string
+	used  map[string]bool
+	err   error
+}
+
+func newOptions(v *fastjson.Value, where string) (*options, error) {
+	obj, err := v.Object()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline: %s is not an object", where)
+	}
+	return &options{obj: obj, where: where, used: make(map[string]bool)}, nil
+}
+
+func (o *options) get(key string) *fastjson.Value {
+	o.used[key] = true
+	return o.obj.Get(key)
+}
+
+// string returns a string option, or "" if it is not set.
+func (o *options) string(key string) string {
+	v := o.get(key)
+	if v == nil {
+		return ""
+	}
+	if v.Type() != fastjson.TypeString {
+		o.setErr(fmt.Errorf("'%s' is not a string", key))
+		return ""
+	}
+	return string(v.GetStringBytes())
+}
+
+// requiredString returns a string option that must be set.
+func (o *options) requiredString(key string) string {
+	s := o.string(key)
+	if s == "" {
+		o.setErr(fmt.Errorf("'%s' is required", key))
+	}
+	return s
+}
+
+// bool returns a bool option, or false if it is not set.
+func (o *options) bool(key string) bool {
+	v := o.get(key)
+	if v == nil {
+		return false
+	}
+	b, err := v.Bool()
+	if err != nil {
+		o.setErr(fmt.Errorf("'%s' is not a boolean", key))
+	}
+	return b
+}
+
+// boolDefault returns a bool option, or `dflt` if it is not set.
+func (o *options) boolDefault(key string, dflt bool) bool {
+	if o.obj.Get(key) == nil {
+		o.used[key] = true
+		return dflt
+	}
+	return o.bool(key)
+}
+
+// strings returns an option that is an array of strings.
+func (o *options) strings(key string) []string {
+	v := o.get(key)
+	if v == nil {
+		return nil
+	}
+	arr, err := v.Array()
+	if err != nil {
+		o.setErr(fmt.Errorf("'%s' is not an array", key))
+		return nil
+	}
+	var ss []string
+	for _, sv := range arr {
+		if sv.Type() != fastjson.TypeString {
+			o.setErr(fmt.Errorf("'%s' is not an array of strings", key))
+			return nil
+		}
+		ss = append(ss, string(sv.GetStringBytes()))
+	}
+	return ss
+}
+
+// stringOrStrings returns an option that is a string or an array of strings.
+func (o *options) stringOrStrings(key string) []string {
+	v := o.obj.Get(key)
+	if v != nil && v.Type() == fastjson.TypeString {
+		return []string{o.string(key)}
+	}
+	return o.strings(key)
+}
+
+func (o *options) setErr(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+// finish returns the first error with an option, if any, or an error for
+// the first unsupported option.
+func (o *options) finish() error {
+	if o.err != nil {
+		return o.err
+	}
+	var unsupported []string
+	o.obj.Visit(func(k []byte, v *fastjson.Value) {
+		if !o.used[string(k)] {
+			unsupported = append(unsupported, string(k))
+		}
+	})
+	if len(unsupported) > 0 {
+		return fmt.Errorf("unsupported option '%s'", unsupported[0])
+	}
+	return nil
+}
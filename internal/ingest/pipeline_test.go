@@ -0,0 +1,416 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fastjson"
+)
+
+func equalErrSubstr(err error, errSubstr string) bool {
+	if err == nil {
+		return errSubstr == ""
+	} else if errSubstr == "" {
+		return false
+	}
+	return strings.Contains(err.Error(), errSubstr)
+}
+
+type loadTestCase struct {
+	name      string
+	pipeline  string
+	errSubstr string // expected substring of error from loading
+}
+
+var loadTestCases = []loadTestCase{
+	{
+		"minimal",
+		`{"processors": []}`,
+		"",
+	},
+	{
+		"invalid JSON",
+		`{"processors": [`,
+		"invalid pipeline JSON",
+	},
+	{
+		"missing processors",
+		`{"description": "foo"}`,
+		"missing 'processors'",
+	},
+	{
+		"unknown pipeline option",
+		`{"processors": [], "blah": 42}`,
+		"unsupported option 'blah'",
+	},
+	{
+		"unsupported processor",
+		`{"processors": [{"set": {"field": "a", "value": 1}}, {"geoip": {"field": "ip"}}]}`,
+		"processors[1]: unsupported processor 'geoip' (supported processors: convert, date, dissect, grok, json, lowercase, remove, rename, set)",
+	},
+	{
+		"not a single processor",
+		`{"processors": [{"set": {"field": "a", "value": 1}, "remove": {"field": "b"}}]}`,
+		"processors[0] is not an object with a single processor type",
+	},
+	{
+		"unsupported processor option",
+		`{"processors": [{"rename": {"field": "a", "target_field": "b", "override": true}}]}`,
+		"processors[0] (rename): unsupported option 'override'",
+	},
+	{
+		"missing required option",
+		`{"processors": [{"rename": {"field": "a"}}]}`,
+		"'target_field' is required",
+	},
+	{
+		"unsupported processor in on_failure",
+		`{"processors": [{"rename": {"field": "a", "target_field": "b", "on_failure": [{"fail": {"message": "x"}}]}}]}`,
+		"processors[0] (rename).on_failure[0]: unsupported processor 'fail'",
+	},
+	{
+		"unsupported condition",
+		`{"processors": [{"remove": {"field": "a", "if": "ctx.a =~ /foo/"}}]}`,
+		"unsupported 'if' condition: unexpected character '=' at position 6",
+	},
+	{
+		"unsupported condition lang",
+		`{"processors": [{"remove": {"field": "a", "if": {"source": "true", "lang": "mustache"}}}]}`,
+		"unsupported 'if' script lang 'mustache'",
+	},
+	{
+		"unknown grok pattern",
+		`{"processors": [{"grok": {"field": "message", "patterns": ["%{NOPE:a}"]}}]}`,
+		"unable to find pattern [NOPE]",
+	},
+	{
+		"circular grok pattern",
+		`{"processors": [{"grok": {"field": "message", "patterns": ["%{A:a}"], "pattern_definitions": {"A": "%{B}", "B": "%{A}"}}}]}`,
+		"circular reference in grok pattern [A]",
+	},
+	{
+		"bad convert type",
+		`{"processors": [{"convert": {"field": "a", "type": "date"}}]}`,
+		"type [date] not supported",
+	},
+	{
+		"bad date format",
+		`{"processors": [{"date": {"field": "a", "formats": ["yyyy-MM-dd QQQ"]}}]}`,
+		"unsupported pattern letter 'Q'",
+	},
+}
+
+func TestLoad(t *testing.T) {
+	for _, tc := range loadTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load([]byte(tc.pipeline))
+			if !equalErrSubstr(err, tc.errSubstr) {
+				t.Errorf("%s:\ngot error:\n\t%v\nexpected error with this substring:\n\t%q\n",
+					tc.name, err, tc.errSubstr)
+			}
+		})
+	}
+}
+
+type runTestCase struct {
+	name      string
+	pipeline  string
+	input     string
+	output    string // the expected record after processing
+	errSubstr string // expected substring of error from running
+}
+
+var runTestCases = []runTestCase{
+	// set
+	{
+		"set",
+		`{"processors": [{"set": {"field": "service.name", "value": "billing"}}]}`,
+		`{"message": "hi"}`,
+		`{"message":"hi","service":{"name":"billing"}}`,
+		"",
+	},
+	{
+		"set with template",
+		`{"processors": [{"set": {"field": "greeting", "value": "hi {{user.name}}!"}}]}`,
+		`{"user": {"name": "bob"}}`,
+		`{"user":{"name":"bob"},"greeting":"hi bob!"}`,
+		"",
+	},
+	{
+		"set with override false",
+		`{"processors": [{"set": {"field": "a", "value": 2, "override": false}}]}`,
+		`{"a": 1}`,
+		`{"a":1}`,
+		"",
+	},
+	{
+		"set with copy_from",
+		`{"processors": [{"set": {"field": "b", "copy_from": "a"}}]}`,
+		`{"a": [1, 2]}`,
+		`{"a":[1,2],"b":[1,2]}`,
+		"",
+	},
+	{
+		"set a dotted field name",
+		`{"processors": [{"set": {"field": "log.level", "value": "warn"}}]}`,
+		`{"log.level": "info"}`,
+		`{"log.level":"warn"}`,
+		"",
+	},
+
+	// remove, rename, lowercase
+	{
+		"remove",
+		`{"processors": [{"remove": {"field": ["a", "b.c"]}}]}`,
+		`{"a": 1, "b": {"c": 2, "d": 3}}`,
+		`{"b":{"d":3}}`,
+		"",
+	},
+	{
+		"remove missing",
+		`{"processors": [{"remove": {"field": "nope"}}]}`,
+		`{"a": 1}`,
+		`{"a":1}`,
+		"remove processor failed: field [nope] not present as part of path [nope]",
+	},
+	{
+		"remove missing, ignore_missing",
+		`{"processors": [{"remove": {"field": "nope", "ignore_missing": true}}]}`,
+		`{"a": 1}`,
+		`{"a":1}`,
+		"",
+	},
+	{
+		"rename",
+		`{"processors": [{"rename": {"field": "msg", "target_field": "message"}}]}`,
+		`{"msg": "hi", "a": 1}`,
+		`{"a":1,"message":"hi"}`,
+		"",
+	},
+	{
+		"rename to existing field",
+		`{"processors": [{"rename": {"field": "msg", "target_field": "message", "tag": "msg2message"}}]}`,
+		`{"msg": "hi", "message": "there"}`,
+		`{"msg":"hi","message":"there"}`,
+		"rename processor [msg2message] failed: field [message] already exists",
+	},
+	{
+		"lowercase",
+		`{"processors": [{"lowercase": {"field": "level", "target_field": "log.level"}}]}`,
+		`{"level": "WARN"}`,
+		`{"level":"WARN","log":{"level":"warn"}}`,
+		"",
+	},
+
+	// convert, json
+	{
+		"convert",
+		`{"processors": [
+			{"convert": {"field": "a", "type": "integer"}},
+			{"convert": {"field": "b", "type": "float"}},
+			{"convert": {"field": "c", "type": "boolean"}},
+			{"convert": {"field": "d", "type": "string"}},
+			{"convert": {"field": "e", "type": "auto"}}
+		]}`,
+		`{"a": "42", "b": "1.5", "c": "TRUE", "d": 3, "e": ["1", "x", "false"]}`,
+		`{"a":42,"b":1.5,"c":true,"d":"3","e":[1,"x",false]}`,
+		"",
+	},
+	{
+		"convert failure",
+		`{"processors": [{"convert": {"field": "a", "type": "long"}}]}`,
+		`{"a": "forty-two"}`,
+		`{"a":"forty-two"}`,
+		"convert processor failed: unable to convert [forty-two] to long",
+	},
+	{
+		"json",
+		`{"processors": [{"json": {"field": "payload", "target_field": "data"}}]}`,
+		`{"payload": "{\"a\": [1, \"two\"]}"}`,
+		`{"payload":"{\"a\": [1, \"two\"]}","data":{"a":[1,"two"]}}`,
+		"",
+	},
+	{
+		"json add_to_root",
+		`{"processors": [{"json": {"field": "message", "add_to_root": true}}, {"remove": {"field": "message"}}]}`,
+		`{"message": "{\"log.level\": \"info\", \"msg\": \"hi\"}"}`,
+		`{"log.level":"info","msg":"hi"}`,
+		"",
+	},
+
+	// grok
+	{
+		"grok",
+		`{"processors": [{"grok": {
+			"field": "message",
+			"patterns": ["%{IP:client.ip} %{WORD:http.request.method} %{URIPATHPARAM:url.original} %{NUMBER:http.response.bytes:int} %{NUMBER:event.duration:float}"]
+		}}]}`,
+		`{"message": "55.3.244.1 GET /index.html 15824 0.043"}`,
+		`{"message":"55.3.244.1 GET /index.html 15824 0.043","client":{"ip":"55.3.244.1"},"http":{"request":{"method":"GET"},"response":{"bytes":15824}},"url":{"original":"/index.html"},"event":{"duration":0.043}}`,
+		"",
+	},
+	{
+		"grok, first matching pattern wins, custom patterns",
+		`{"processors": [{"grok": {
+			"field": "message",
+			"patterns": ["^%{LOGLEVEL:log.level} %{GREEDYDATA:message}$", "^\\[%{SVC:service.name}\\] %{GREEDYDATA:message}$"],
+			"pattern_definitions": {"SVC": "[a-z-]+"}
+		}}]}`,
+		`{"message": "[auth-api] started"}`,
+		`{"message":"started","service":{"name":"auth-api"}}`,
+		"",
+	},
+	{
+		"grok, no match",
+		`{"processors": [{"grok": {"field": "message", "patterns": ["^%{INT:n}$"]}}]}`,
+		`{"message": "hi"}`,
+		`{"message":"hi"}`,
+		"grok processor failed: Provided Grok expressions do not match field value: [hi]",
+	},
+	{
+		"grok, timestamp",
+		`{"processors": [{"grok": {"field": "message", "patterns": ["^%{TIMESTAMP_ISO8601:ts} \\[%{LOGLEVEL:log.level}\\s*\\] %{GREEDYDATA:message}"]}}]}`,
+		`{"message": "2021-02-03T04:05:06.789Z [WARN ] disk full"}`,
+		`{"message":"disk full","ts":"2021-02-03T04:05:06.789Z","log":{"level":"WARN"}}`,
+		"",
+	},
+
+	// dissect
+	{
+		"dissect",
+		`{"processors": [{"dissect": {"field": "message", "pattern": "[%{@timestamp}] [%{log.level}] %{message}"}}]}`,
+		`{"message": "[2021-02-03T04:05:06Z] [info] hello there"}`,
+		`{"message":"hello there","@timestamp":"2021-02-03T04:05:06Z","log":{"level":"info"}}`,
+		"",
+	},
+	{
+		"dissect, modifiers",
+		`{"processors": [{"dissect": {
+			"field": "message",
+			"pattern": "%{+name/2} %{+name/1} %{?skip} %{level->} %{*k}=%{&k}",
+			"append_separator": " "
+		}}]}`,
+		`{"message": "Smith John ignored warn     user=bob"}`,
+		`{"message":"Smith John ignored warn     user=bob","level":"warn","name":"John Smith","user":"bob"}`,
+		"",
+	},
+	{
+		"dissect, no match",
+		`{"processors": [{"dissect": {"field": "message", "pattern": "%{a}|%{b}"}}]}`,
+		`{"message": "a b"}`,
+		`{"message":"a b"}`,
+		"Unable to find match for dissect pattern: %{a}|%{b} against source: a b",
+	},
+
+	// date
+	{
+		"date, ISO8601",
+		`{"processors": [{"date": {"field": "ts", "formats": ["ISO8601"]}}]}`,
+		`{"ts": "2021-02-03T04:05:06.789+01:00"}`,
+		`{"ts":"2021-02-03T04:05:06.789+01:00","@timestamp":"2021-02-03T03:05:06.789Z"}`,
+		"",
+	},
+	{
+		"date, Java pattern and timezone",
+		`{"processors": [{"date": {
+			"field": "ts",
+			"target_field": "event.created",
+			"formats": ["dd/MMM/yyyy:HH:mm:ss Z", "yyyy-MM-dd HH:mm:ss,SSS"],
+			"timezone": "UTC",
+			"output_format": "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+		}}]}`,
+		`{"ts": "10/Oct/2000:13:55:36 -0700"}`,
+		`{"ts":"10/Oct/2000:13:55:36 -0700","event":{"created":"2000-10-10T20:55:36.000Z"}}`,
+		"",
+	},
+	{
+		"date, UNIX_MS",
+		`{"processors": [{"date": {"field": "time", "formats": ["UNIX_MS"]}}, {"remove": {"field": "time"}}]}`,
+		`{"time": 1612325106789}`,
+		`{"@timestamp":"2021-02-03T04:05:06.789Z"}`,
+		"",
+	},
+	{
+		"date, no match",
+		`{"processors": [{"date": {"field": "ts", "formats": ["UNIX"]}}]}`,
+		`{"ts": "yesterday"}`,
+		`{"ts":"yesterday"}`,
+		"date processor failed: unable to parse date [yesterday]",
+	},
+
+	// if, on_failure, ignore_failure
+	{
+		"if",
+		`{"processors": [
+			{"set": {"field": "a", "value": "yes", "if": "ctx.log?.level == 'error'"}},
+			{"set": {"field": "b", "value": "yes", "if": "ctx.log?.level != 'error'"}}
+		]}`,
+		`{"log": {"level": "error"}}`,
+		`{"log":{"level":"error"},"a":"yes"}`,
+		"",
+	},
+	{
+		"if error is a processor failure",
+		`{"processors": [{"set": {"field": "a", "value": "yes", "if": "ctx.log.level == 'error'"}}]}`,
+		`{"message": "hi"}`,
+		`{"message":"hi"}`,
+		"set processor failed: error evaluating condition [ctx.log.level == 'error']: cannot access field [level] of null",
+	},
+	{
+		"processor on_failure",
+		`{"processors": [
+			{"rename": {"field": "nope", "target_field": "yup", "tag": "r1", "on_failure": [
+				{"set": {"field": "error.message", "value": "{{_ingest.on_failure_processor_type}} [{{_ingest.on_failure_processor_tag}}]: {{_ingest.on_failure_message}}"}}
+			]}},
+			{"set": {"field": "after", "value": true}}
+		]}`,
+		`{"message": "hi"}`,
+		`{"message":"hi","error":{"message":"rename [r1]: field [nope] doesn't exist"},"after":true}`,
+		"",
+	},
+	{
+		"pipeline on_failure stops processing",
+		`{
+			"processors": [
+				{"convert": {"field": "n", "type": "integer"}},
+				{"set": {"field": "after", "value": true}}
+			],
+			"on_failure": [{"set": {"field": "error.message", "value": "{{ _ingest.on_failure_message }}"}}]
+		}`,
+		`{"n": "x"}`,
+		`{"n":"x","error":{"message":"unable to convert [x] to integer"}}`,
+		"",
+	},
+	{
+		"ignore_failure",
+		`{"processors": [
+			{"convert": {"field": "n", "type": "integer", "ignore_failure": true}},
+			{"set": {"field": "after", "value": true}}
+		]}`,
+		`{"n": "x"}`,
+		`{"n":"x","after":true}`,
+		"",
+	},
+}
+
+func TestRun(t *testing.T) {
+	for _, tc := range runTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Load([]byte(tc.pipeline))
+			if err != nil {
+				t.Fatalf("%s: could not load pipeline: %s", tc.name, err)
+			}
+			rec := fastjson.MustParse(tc.input)
+			var arena fastjson.Arena
+			err = p.Run(rec, &arena)
+			if !equalErrSubstr(err, tc.errSubstr) {
+				t.Errorf("%s:\ngot error:\n\t%v\nexpected error with this substring:\n\t%q\n",
+					tc.name, err, tc.errSubstr)
+			}
+			if got := rec.String(); got != tc.output {
+				t.Errorf("%s:\ngot record:\n\t%s\nexpected record:\n\t%s\n",
+					tc.name, got, tc.output)
+			}
+		})
+	}
+}
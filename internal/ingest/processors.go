@@ -0,0 +1,376 @@
+package ingest
+
+// The simpler processors. See grok.go, dissect.go, and date.go for others.
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// templateRe matches a Mustache variable, e.g. "{{foo.bar}}" or
+// "{{{foo.bar}}}".
+var templateRe = regexp.MustCompile(`\{\{\{?\s*([^{}\s]+)\s*\}?\}\}`)
+
+// template is a string option that may reference fields as Mustache
+// variables, as in Elasticsearch's "set" processor.
+type template string
+
+// render returns the template with variables replaced by the referenced
+// field values. Missing fields are replaced with an empty string.
+func (t template) render(d *document) string {
+	if !strings.Contains(string(t), "{{") {
+		return string(t)
+	}
+	return templateRe.ReplaceAllStringFunc(string(t), func(m string) string {
+		name := templateRe.FindStringSubmatch(m)[1]
+		v := d.getField(name)
+		if v == nil {
+			return ""
+		} else if v.Type() == fastjson.TypeString {
+			return string(v.GetStringBytes())
+		}
+		return v.String()
+	})
+}
+
+// unescapeAll unescapes all strings and object keys in `v`. fastjson does
+// this lazily, on first access, so this makes `v` safe for concurrent use
+// when processing records in parallel.
+func unescapeAll(v *fastjson.Value) {
+	switch v.Type() {
+	case fastjson.TypeString:
+		v.GetStringBytes()
+	case fastjson.TypeArray:
+		for _, item := range v.GetArray() {
+			unescapeAll(item)
+		}
+	case fastjson.TypeObject:
+		v.GetObject().Visit(func(k []byte, item *fastjson.Value) {
+			unescapeAll(item)
+		})
+	}
+}
+
+// ---- set
+
+type setProcessor struct {
+	field            template
+	value            *fastjson.Value
+	copyFrom         string
+	override         bool
+	ignoreEmptyValue bool
+}
+
+func newSetProcessor(opts *options) (processor, error) {
+	p := &setProcessor{
+		field:            template(opts.requiredString("field")),
+		value:            opts.get("value"),
+		copyFrom:         opts.string("copy_from"),
+		override:         opts.boolDefault("override", true),
+		ignoreEmptyValue: opts.bool("ignore_empty_value"),
+	}
+	if (p.value == nil) == (p.copyFrom == "") {
+		return nil, fmt.Errorf("exactly one of 'value' or 'copy_from' is required")
+	}
+	if p.value != nil {
+		unescapeAll(p.value)
+	}
+	return p, nil
+}
+
+func (p *setProcessor) run(d *document) error {
+	field := p.field.render(d)
+	if !p.override {
+		if v := d.getField(field); v != nil && v.Type() != fastjson.TypeNull {
+			return nil
+		}
+	}
+	var v *fastjson.Value
+	if p.copyFrom != "" {
+		v = d.getField(p.copyFrom)
+		if v == nil {
+			if p.ignoreEmptyValue {
+				return nil
+			}
+			return fmt.Errorf("field [%s] not present as part of path [%s]", p.copyFrom, p.copyFrom)
+		}
+	} else {
+		v = d.renderValue(p.value)
+		if p.ignoreEmptyValue && (v.Type() == fastjson.TypeNull ||
+			(v.Type() == fastjson.TypeString && len(v.GetStringBytes()) == 0)) {
+			return nil
+		}
+	}
+	return d.setField(field, v)
+}
+
+// renderValue returns a copy of `v` with templates in strings rendered.
+func (d *document) renderValue(v *fastjson.Value) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeString:
+		return d.arena.NewString(template(v.GetStringBytes()).render(d))
+	case fastjson.TypeArray:
+		arr := d.arena.NewArray()
+		for i, item := range v.GetArray() {
+			arr.SetArrayItem(i, d.renderValue(item))
+		}
+		return arr
+	case fastjson.TypeObject:
+		obj := d.arena.NewObject()
+		v.GetObject().Visit(func(k []byte, item *fastjson.Value) {
+			obj.Set(string(k), d.renderValue(item))
+		})
+		return obj
+	}
+	return v
+}
+
+// ---- remove
+
+type removeProcessor struct {
+	fields        []template
+	ignoreMissing bool
+}
+
+func newRemoveProcessor(opts *options) (processor, error) {
+	p := &removeProcessor{ignoreMissing: opts.bool("ignore_missing")}
+	for _, f := range opts.stringOrStrings("field") {
+		p.fields = append(p.fields, template(f))
+	}
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("'field' is required")
+	}
+	return p, nil
+}
+
+func (p *removeProcessor) run(d *document) error {
+	for _, f := range p.fields {
+		field := f.render(d)
+		if !d.removeField(field) && !p.ignoreMissing {
+			return fmt.Errorf("field [%s] not present as part of path [%s]", field, field)
+		}
+	}
+	return nil
+}
+
+// ---- rename
+
+type renameProcessor struct {
+	field         template
+	targetField   template
+	ignoreMissing bool
+}
+
+func newRenameProcessor(opts *options) (processor, error) {
+	return &renameProcessor{
+		field:         template(opts.requiredString("field")),
+		targetField:   template(opts.requiredString("target_field")),
+		ignoreMissing: opts.bool("ignore_missing"),
+	}, nil
+}
+
+func (p *renameProcessor) run(d *document) error {
+	field := p.field.render(d)
+	target := p.targetField.render(d)
+	v := d.getField(field)
+	if v == nil {
+		if p.ignoreMissing {
+			return nil
+		}
+		return fmt.Errorf("field [%s] doesn't exist", field)
+	}
+	if d.getField(target) != nil {
+		return fmt.Errorf("field [%s] already exists", target)
+	}
+	d.removeField(field)
+	return d.setField(target, v)
+}
+
+// ---- lowercase
+
+type lowercaseProcessor struct {
+	field         string
+	targetField   string
+	ignoreMissing bool
+}
+
+func newLowercaseProcessor(opts *options) (processor, error) {
+	p := &lowercaseProcessor{
+		field:         opts.requiredString("field"),
+		targetField:   opts.string("target_field"),
+		ignoreMissing: opts.bool("ignore_missing"),
+	}
+	if p.targetField == "" {
+		p.targetField = p.field
+	}
+	return p, nil
+}
+
+func (p *lowercaseProcessor) run(d *document) error {
+	s, ok, err := d.stringField(p.field, p.ignoreMissing)
+	if !ok {
+		return err
+	}
+	return d.setField(p.targetField, d.arena.NewString(strings.ToLower(s)))
+}
+
+// ---- convert
+
+type convertProcessor struct {
+	field         string
+	targetField   string
+	typ           string
+	ignoreMissing bool
+}
+
+func newConvertProcessor(opts *options) (processor, error) {
+	p := &convertProcessor{
+		field:         opts.requiredString("field"),
+		targetField:   opts.string("target_field"),
+		typ:           opts.requiredString("type"),
+		ignoreMissing: opts.bool("ignore_missing"),
+	}
+	if p.targetField == "" {
+		p.targetField = p.field
+	}
+	switch p.typ {
+	case "", "integer", "long", "float", "double", "boolean", "string", "ip", "auto":
+	default:
+		return nil, fmt.Errorf("type [%s] not supported, must be one of: integer, long, float, double, boolean, string, ip, auto", p.typ)
+	}
+	return p, nil
+}
+
+func (p *convertProcessor) run(d *document) error {
+	v := d.getField(p.field)
+	if v == nil || v.Type() == fastjson.TypeNull {
+		if p.ignoreMissing {
+			return nil
+		}
+		return fmt.Errorf("field [%s] not present as part of path [%s]", p.field, p.field)
+	}
+	var conv *fastjson.Value
+	var err error
+	if v.Type() == fastjson.TypeArray {
+		conv = d.arena.NewArray()
+		for i, item := range v.GetArray() {
+			var c *fastjson.Value
+			if c, err = p.convert(d, item); err != nil {
+				return err
+			}
+			conv.SetArrayItem(i, c)
+		}
+	} else if conv, err = p.convert(d, v); err != nil {
+		return err
+	}
+	return d.setField(p.targetField, conv)
+}
+
+func (p *convertProcessor) convert(d *document, v *fastjson.Value) (*fastjson.Value, error) {
+	// Values are converted from their string form, e.g. the number 42 is
+	// converted to a float from "42".
+	var s string
+	if v.Type() == fastjson.TypeString {
+		s = string(v.GetStringBytes())
+	} else {
+		s = v.String()
+	}
+	switch p.typ {
+	case "integer", "long":
+		bitSize := 64
+		if p.typ == "integer" {
+			bitSize = 32
+		}
+		if _, err := strconv.ParseInt(s, 10, bitSize); err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s", s, p.typ)
+		}
+		return d.arena.NewNumberString(s), nil
+	case "float", "double":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert [%s] to %s", s, p.typ)
+		}
+		return d.arena.NewNumberFloat64(f), nil
+	case "boolean":
+		switch strings.ToLower(s) {
+		case "true":
+			return d.arena.NewTrue(), nil
+		case "false":
+			return d.arena.NewFalse(), nil
+		}
+		return nil, fmt.Errorf("[%s] is not a boolean value, cannot convert to boolean", s)
+	case "string":
+		return d.arena.NewString(s), nil
+	case "ip":
+		if net.ParseIP(s) == nil {
+			return nil, fmt.Errorf("'%s' is not an IP string literal", s)
+		}
+		return d.arena.NewString(s), nil
+	default: // "auto"
+		if v.Type() != fastjson.TypeString {
+			return v, nil
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return d.arena.NewNumberString(s), nil
+		} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return d.arena.NewNumberFloat64(f), nil
+		} else if s == "true" {
+			return d.arena.NewTrue(), nil
+		} else if s == "false" {
+			return d.arena.NewFalse(), nil
+		}
+		return v, nil
+	}
+}
+
+// ---- json
+
+type jsonProcessor struct {
+	field       string
+	targetField string
+	addToRoot   bool
+}
+
+func newJSONProcessor(opts *options) (processor, error) {
+	p := &jsonProcessor{
+		field:       opts.requiredString("field"),
+		targetField: opts.string("target_field"),
+		addToRoot:   opts.bool("add_to_root"),
+	}
+	if p.addToRoot && p.targetField != "" {
+		return nil, fmt.Errorf("cannot set a target field while also setting 'add_to_root' to true")
+	}
+	if p.targetField == "" {
+		p.targetField = p.field
+	}
+	return p, nil
+}
+
+func (p *jsonProcessor) run(d *document) error {
+	s, _, err := d.stringField(p.field, false)
+	if err != nil {
+		return err
+	}
+	// Use a separate parser, because values from the parser of the record
+	// are still in use.
+	v, err := fastjson.Parse(s)
+	if err != nil {
+		return fmt.Errorf("cannot parse JSON in field [%s]: %s", p.field, err)
+	}
+	if !p.addToRoot {
+		return d.setField(p.targetField, v)
+	}
+	obj, err := v.Object()
+	if err != nil {
+		return fmt.Errorf("cannot add non-map fields to root of document")
+	}
+	obj.Visit(func(k []byte, item *fastjson.Value) {
+		d.root.Set(string(k), item)
+	})
+	return nil
+}
@@ -162,3 +162,31 @@ func ExtractValueOfType(obj *fastjson.Value, typ fastjson.Type, lookup ...string
 
 	return nil
 }
+
+// SetValue sets the property identified by object property names in `lookup`
+// to `val`. If the property exists, dotted or undotted (see `LookupValue`), it
+// is replaced. Otherwise it is added to the deepest existing object on the
+// path, with the rest of the path as a dotted name. For example, setting
+// ["host", "hostname"] on `{"host": {"name": "a"}}` results in
+// `{"host": {"name": "a", "hostname": ...}}`, and on `{}` results in
+// `{"host.hostname": ...}`.
+func SetValue(obj *fastjson.Value, val *fastjson.Value, lookup ...string) {
+	if obj == nil || len(lookup) == 0 {
+		return
+	}
+	o := obj.GetObject()
+	if o == nil {
+		return
+	}
+
+	var key string
+	for i := 1; i < len(lookup); i++ {
+		key = strings.Join(lookup[:i], ".")
+		subV := o.Get(key)
+		if subV != nil && subV.Type() == fastjson.TypeObject {
+			SetValue(subV, val, lookup[i:]...)
+			return
+		}
+	}
+	o.Set(strings.Join(lookup, "."), val)
+}
@@ -232,3 +232,30 @@ func TestExtractValue(t *testing.T) {
 		})
 	}
 }
+
+func TestSetValue(t *testing.T) {
+	testCases := []struct {
+		name   string
+		obj    string
+		lookup []string
+		val    string
+		want   string
+	}{
+		{"empty object", `{}`, []string{"foo"}, `"bar"`, `{"foo":"bar"}`},
+		{"new dotted", `{}`, []string{"host", "hostname"}, `"a"`, `{"host.hostname":"a"}`},
+		{"existing object", `{"host":{"name":"a"}}`, []string{"host", "hostname"}, `"b"`, `{"host":{"name":"a","hostname":"b"}}`},
+		{"replace nested", `{"host":{"hostname":"a"}}`, []string{"host", "hostname"}, `"b"`, `{"host":{"hostname":"b"}}`},
+		{"replace dotted", `{"host.hostname":"a"}`, []string{"host", "hostname"}, `"b"`, `{"host.hostname":"b"}`},
+		{"dotted object", `{"a.b":{"c":1}}`, []string{"a", "b", "d"}, `2`, `{"a.b":{"c":1,"d":2}}`},
+		{"non-object on path", `{"a":1}`, []string{"a", "b"}, `2`, `{"a":1,"a.b":2}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := fastjson.MustParse(tc.obj)
+			SetValue(obj, fastjson.MustParse(tc.val), tc.lookup...)
+			if got := obj.String(); got != tc.want {
+				t.Errorf("SetValue(%s, %s, %v): got %s, want %s", tc.obj, tc.val, tc.lookup, got, tc.want)
+			}
+		})
+	}
+}